@@ -0,0 +1,234 @@
+// Copyright 2019, OpenCensus Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package stackdriver
+
+/*
+The code in this file loads exporter options from the environment.
+*/
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"google.golang.org/api/option"
+)
+
+// Config holds the exporter options that can be set without code changes.
+// OptionsFromEnv fills it from STACKDRIVER_* environment variables, named by
+// the env tags of its fields. It can also be decoded with encoding/json,
+// using the keys in the json tags; durations are then given in nanoseconds.
+type Config struct {
+	ProjectID    string `env:"STACKDRIVER_PROJECT_ID" json:"project_id"`
+	Location     string `env:"STACKDRIVER_LOCATION" json:"location"`
+	MetricPrefix string `env:"STACKDRIVER_METRIC_PREFIX" json:"metric_prefix"`
+
+	BundleDelayThreshold      time.Duration `env:"STACKDRIVER_BUNDLE_DELAY_THRESHOLD" json:"bundle_delay_threshold"`
+	BundleCountThreshold      int           `env:"STACKDRIVER_BUNDLE_COUNT_THRESHOLD" json:"bundle_count_threshold"`
+	TraceSpansBufferMaxBytes  int           `env:"STACKDRIVER_TRACE_SPANS_BUFFER_MAX_BYTES" json:"trace_spans_buffer_max_bytes"`
+	TraceSpansMaxRequestBytes int           `env:"STACKDRIVER_TRACE_SPANS_MAX_REQUEST_BYTES" json:"trace_spans_max_request_bytes"`
+	ReportingInterval         time.Duration `env:"STACKDRIVER_REPORTING_INTERVAL" json:"reporting_interval"`
+	Timeout                   time.Duration `env:"STACKDRIVER_TIMEOUT" json:"timeout"`
+
+	// DefaultMonitoringLabels replaces the default "opencensus_task" label
+	// if non-nil. In the environment, labels are written as
+	// "key1=value1,key2=value2"; an empty variable removes all labels.
+	DefaultMonitoringLabels map[string]string `env:"STACKDRIVER_DEFAULT_MONITORING_LABELS" json:"default_monitoring_labels"`
+
+	// DefaultTraceAttributes are written like DefaultMonitoringLabels.
+	DefaultTraceAttributes map[string]string `env:"STACKDRIVER_DEFAULT_TRACE_ATTRIBUTES" json:"default_trace_attributes"`
+
+	// MonitoringEndpoint and TraceEndpoint override the host:port of the
+	// Stackdriver Monitoring and Trace APIs.
+	MonitoringEndpoint string `env:"STACKDRIVER_MONITORING_ENDPOINT" json:"monitoring_endpoint"`
+	TraceEndpoint      string `env:"STACKDRIVER_TRACE_ENDPOINT" json:"trace_endpoint"`
+}
+
+// OptionsFromEnv returns the Options configured by the STACKDRIVER_*
+// environment variables listed in Config. Fields of Options that cannot be
+// set from the environment, such as OnError, can be set on the result before
+// it is passed to NewExporter.
+func OptionsFromEnv() (Options, error) {
+	c, err := ConfigFromEnv()
+	if err != nil {
+		return Options{}, err
+	}
+	return c.Options()
+}
+
+// ConfigFromEnv returns the Config set by the STACKDRIVER_* environment
+// variables. Unset variables leave their fields zero.
+func ConfigFromEnv() (*Config, error) {
+	c := new(Config)
+	if err := c.loadEnv(os.LookupEnv); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+func (c *Config) loadEnv(lookup func(string) (string, bool)) error {
+	var errs []string
+	v := reflect.ValueOf(c).Elem()
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		name := t.Field(i).Tag.Get("env")
+		s, ok := lookup(name)
+		if !ok {
+			continue
+		}
+		if err := setField(v.Field(i), s); err != nil {
+			errs = append(errs, fmt.Sprintf("%s=%q: %v", name, s, err))
+		}
+	}
+	if len(errs) > 0 {
+		return fmt.Errorf("stackdriver: invalid environment: %s", strings.Join(errs, "; "))
+	}
+	return nil
+}
+
+var durationType = reflect.TypeOf(time.Duration(0))
+
+// setField parses s into the Config field f.
+func setField(f reflect.Value, s string) error {
+	s = strings.TrimSpace(s)
+	switch {
+	case f.Type() == durationType:
+		d, err := time.ParseDuration(s)
+		if err != nil {
+			return errors.New("want a duration such as 5s or 500ms")
+		}
+		f.SetInt(int64(d))
+	case f.Kind() == reflect.Int:
+		n, err := strconv.Atoi(s)
+		if err != nil {
+			return errors.New("want an integer")
+		}
+		f.SetInt(int64(n))
+	case f.Kind() == reflect.String:
+		f.SetString(s)
+	case f.Kind() == reflect.Map:
+		m, err := parseKeyValues(s)
+		if err != nil {
+			return err
+		}
+		f.Set(reflect.ValueOf(m))
+	default:
+		return fmt.Errorf("unsupported field type %v", f.Type())
+	}
+	return nil
+}
+
+// parseKeyValues parses "key1=value1,key2=value2". An empty string yields
+// an empty, non-nil map.
+func parseKeyValues(s string) (map[string]string, error) {
+	m := make(map[string]string)
+	if s == "" {
+		return m, nil
+	}
+	for _, kv := range strings.Split(s, ",") {
+		i := strings.Index(kv, "=")
+		if i < 0 {
+			return nil, fmt.Errorf("%q is not of the form key=value", kv)
+		}
+		key := strings.TrimSpace(kv[:i])
+		if key == "" {
+			return nil, fmt.Errorf("%q has an empty key", kv)
+		}
+		m[key] = strings.TrimSpace(kv[i+1:])
+	}
+	return m, nil
+}
+
+// Options validates c and returns the corresponding Options.
+func (c *Config) Options() (Options, error) {
+	if err := c.validate(); err != nil {
+		return Options{}, err
+	}
+	o := Options{
+		ProjectID:                 c.ProjectID,
+		Location:                  c.Location,
+		MetricPrefix:              c.MetricPrefix,
+		BundleDelayThreshold:      c.BundleDelayThreshold,
+		BundleCountThreshold:      c.BundleCountThreshold,
+		TraceSpansBufferMaxBytes:  c.TraceSpansBufferMaxBytes,
+		TraceSpansMaxRequestBytes: c.TraceSpansMaxRequestBytes,
+		ReportingInterval:         c.ReportingInterval,
+		Timeout:                   c.Timeout,
+	}
+	if c.DefaultMonitoringLabels != nil {
+		labels := &Labels{}
+		for k, v := range c.DefaultMonitoringLabels {
+			labels.Set(k, v, "")
+		}
+		o.DefaultMonitoringLabels = labels
+	}
+	if len(c.DefaultTraceAttributes) > 0 {
+		o.DefaultTraceAttributes = make(map[string]interface{}, len(c.DefaultTraceAttributes))
+		for k, v := range c.DefaultTraceAttributes {
+			o.DefaultTraceAttributes[k] = v
+		}
+	}
+	if c.MonitoringEndpoint != "" {
+		o.MonitoringClientOptions = []option.ClientOption{option.WithEndpoint(c.MonitoringEndpoint)}
+	}
+	if c.TraceEndpoint != "" {
+		o.TraceClientOptions = []option.ClientOption{option.WithEndpoint(c.TraceEndpoint)}
+	}
+	return o, nil
+}
+
+func (c *Config) validate() error {
+	var errs []string
+	for name, n := range map[string]int64{
+		"bundle delay threshold":        int64(c.BundleDelayThreshold),
+		"bundle count threshold":        int64(c.BundleCountThreshold),
+		"trace spans buffer max bytes":  int64(c.TraceSpansBufferMaxBytes),
+		"trace spans max request bytes": int64(c.TraceSpansMaxRequestBytes),
+		"reporting interval":            int64(c.ReportingInterval),
+		"timeout":                       int64(c.Timeout),
+	} {
+		if n < 0 {
+			errs = append(errs, name+" must not be negative")
+		}
+	}
+	for name, endpoint := range map[string]string{
+		"monitoring endpoint": c.MonitoringEndpoint,
+		"trace endpoint":      c.TraceEndpoint,
+	} {
+		if endpoint == "" {
+			continue
+		}
+		if _, _, err := net.SplitHostPort(endpoint); err != nil {
+			errs = append(errs, fmt.Sprintf("%s %q must be of the form host:port", name, endpoint))
+		}
+	}
+	for k := range c.DefaultMonitoringLabels {
+		if k == "" {
+			errs = append(errs, "default monitoring labels must not have empty keys")
+			break
+		}
+	}
+	if len(errs) > 0 {
+		sort.Strings(errs)
+		return fmt.Errorf("stackdriver: invalid config: %s", strings.Join(errs, "; "))
+	}
+	return nil
+}
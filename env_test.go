@@ -0,0 +1,150 @@
+// Copyright 2019, OpenCensus Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package stackdriver
+
+import (
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func lookupFrom(env map[string]string) func(string) (string, bool) {
+	return func(key string) (string, bool) {
+		v, ok := env[key]
+		return v, ok
+	}
+}
+
+func TestConfigFromEnv(t *testing.T) {
+	var c Config
+	err := c.loadEnv(lookupFrom(map[string]string{
+		"STACKDRIVER_PROJECT_ID":                "my-project",
+		"STACKDRIVER_LOCATION":                  "us-central1-a",
+		"STACKDRIVER_METRIC_PREFIX":             "myapp/",
+		"STACKDRIVER_BUNDLE_DELAY_THRESHOLD":    "500ms",
+		"STACKDRIVER_BUNDLE_COUNT_THRESHOLD":    " 100 ",
+		"STACKDRIVER_REPORTING_INTERVAL":        "1m",
+		"STACKDRIVER_TIMEOUT":                   "10s",
+		"STACKDRIVER_DEFAULT_MONITORING_LABELS": "env=prod, team = payments",
+		"STACKDRIVER_DEFAULT_TRACE_ATTRIBUTES":  "region=us",
+		"STACKDRIVER_TRACE_ENDPOINT":            "localhost:9090",
+	}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := Config{
+		ProjectID:               "my-project",
+		Location:                "us-central1-a",
+		MetricPrefix:            "myapp/",
+		BundleDelayThreshold:    500 * time.Millisecond,
+		BundleCountThreshold:    100,
+		ReportingInterval:       time.Minute,
+		Timeout:                 10 * time.Second,
+		DefaultMonitoringLabels: map[string]string{"env": "prod", "team": "payments"},
+		DefaultTraceAttributes:  map[string]string{"region": "us"},
+		TraceEndpoint:           "localhost:9090",
+	}
+	if !reflect.DeepEqual(c, want) {
+		t.Fatalf("Config = %+v; want %+v", c, want)
+	}
+
+	o, err := c.Options()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if o.ProjectID != "my-project" || o.BundleCountThreshold != 100 || o.Timeout != 10*time.Second {
+		t.Errorf("Options = %+v", o)
+	}
+	wantLabels := map[string]labelValue{"env": {val: "prod"}, "team": {val: "payments"}}
+	if o.DefaultMonitoringLabels == nil || !reflect.DeepEqual(o.DefaultMonitoringLabels.m, wantLabels) {
+		t.Errorf("DefaultMonitoringLabels = %v; want %v", o.DefaultMonitoringLabels, wantLabels)
+	}
+	if got, want := o.DefaultTraceAttributes, map[string]interface{}{"region": "us"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("DefaultTraceAttributes = %v; want %v", got, want)
+	}
+	if len(o.TraceClientOptions) != 1 || len(o.MonitoringClientOptions) != 0 {
+		t.Errorf("got %d trace and %d monitoring client options; want 1 and 0", len(o.TraceClientOptions), len(o.MonitoringClientOptions))
+	}
+}
+
+func TestConfigFromEnvEmptyLabels(t *testing.T) {
+	var c Config
+	if err := c.loadEnv(lookupFrom(map[string]string{"STACKDRIVER_DEFAULT_MONITORING_LABELS": ""})); err != nil {
+		t.Fatal(err)
+	}
+	o, err := c.Options()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if o.DefaultMonitoringLabels == nil || len(o.DefaultMonitoringLabels.m) != 0 {
+		t.Errorf("DefaultMonitoringLabels = %v; want empty labels", o.DefaultMonitoringLabels)
+	}
+}
+
+func TestConfigFromJSON(t *testing.T) {
+	var c Config
+	err := json.Unmarshal([]byte(`{
+		"project_id": "proj",
+		"bundle_count_threshold": 50,
+		"reporting_interval": 60000000000,
+		"default_monitoring_labels": {"env": "prod"}
+	}`), &c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := Config{
+		ProjectID:               "proj",
+		BundleCountThreshold:    50,
+		ReportingInterval:       time.Minute,
+		DefaultMonitoringLabels: map[string]string{"env": "prod"},
+	}
+	if !reflect.DeepEqual(c, want) {
+		t.Errorf("decoded Config = %+v; want %+v", c, want)
+	}
+}
+
+func TestConfigErrors(t *testing.T) {
+	var c Config
+	err := c.loadEnv(lookupFrom(map[string]string{
+		"STACKDRIVER_TIMEOUT":                   "5",
+		"STACKDRIVER_BUNDLE_COUNT_THRESHOLD":    "many",
+		"STACKDRIVER_DEFAULT_MONITORING_LABELS": "env",
+	}))
+	if err == nil {
+		t.Fatal("loadEnv() succeeded; want error")
+	}
+	for _, want := range []string{
+		`STACKDRIVER_TIMEOUT="5": want a duration`,
+		`STACKDRIVER_BUNDLE_COUNT_THRESHOLD="many": want an integer`,
+		`STACKDRIVER_DEFAULT_MONITORING_LABELS="env": "env" is not of the form key=value`,
+	} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("error %q does not contain %q", err, want)
+		}
+	}
+
+	c = Config{Timeout: -time.Second, TraceEndpoint: "localhost"}
+	_, err = c.Options()
+	if err == nil {
+		t.Fatal("Options() succeeded; want error")
+	}
+	for _, want := range []string{"timeout must not be negative", `trace endpoint "localhost" must be of the form host:port`} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("error %q does not contain %q", err, want)
+		}
+	}
+}
@@ -0,0 +1,241 @@
+// Copyright 2019, OpenCensus Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package stackdriver
+
+/*
+The code in this file reports spans ending with a non-OK status to
+Cloud Error Reporting.
+*/
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path"
+	"runtime"
+	"strings"
+	"sync"
+	"time"
+
+	errorreporting "cloud.google.com/go/errorreporting/apiv1beta1"
+	"github.com/golang/protobuf/ptypes"
+	"go.opencensus.io/trace"
+	"google.golang.org/api/option"
+	monitoredrespb "google.golang.org/genproto/googleapis/api/monitoredres"
+	erpb "google.golang.org/genproto/googleapis/devtools/clouderrorreporting/v1beta1"
+)
+
+const (
+	defaultErrorReportingEventsPerSecond = 1
+	defaultErrorReportingBurst           = 10
+)
+
+// ErrorReportingOptions configures the reporting of failed spans to Cloud
+// Error Reporting.
+type ErrorReportingOptions struct {
+	// ClientOptions are additional options to be passed to the underlying
+	// Error Reporting API client.
+	// Optional.
+	ClientOptions []option.ClientOption
+
+	// Service and Version identify the reporting service. If unset, they are
+	// taken from the monitored resource of each span, as selected by
+	// Options.SpanResource, e.g. the service and revision of a Cloud Run
+	// revision, falling back to the program name.
+	// Optional.
+	Service string
+	Version string
+
+	// EventsPerSecond is the sustained rate of reported events, and Burst
+	// the number of events that may be reported at once. Events beyond the
+	// rate are dropped. Defaults to 1 event per second with bursts of 10.
+	// Optional.
+	EventsPerSecond float64
+	Burst           int
+}
+
+// errorReporter sends an error event for each span ending with a non-OK
+// status, subject to a rate limit.
+type errorReporter struct {
+	client  *errorreporting.ReportErrorsClient
+	limiter *rateLimiter
+	o       Options
+
+	wg sync.WaitGroup
+}
+
+func newErrorReporter(o Options, client *errorreporting.ReportErrorsClient) *errorReporter {
+	eo := o.ErrorReporting
+	rate, burst := eo.EventsPerSecond, eo.Burst
+	if rate <= 0 {
+		rate = defaultErrorReportingEventsPerSecond
+	}
+	if burst <= 0 {
+		burst = defaultErrorReportingBurst
+	}
+	return &errorReporter{
+		client:  client,
+		limiter: newRateLimiter(rate, burst),
+		o:       o,
+	}
+}
+
+// errorServiceContext returns the service context of the error events of
+// spans with the monitored resource mr, derived from mr unless set in eo.
+func errorServiceContext(eo *ErrorReportingOptions, mr *monitoredrespb.MonitoredResource) *erpb.ServiceContext {
+	sc := &erpb.ServiceContext{}
+	if mr != nil {
+		labels := mr.GetLabels()
+		switch mr.GetType() {
+		case "cloud_run_revision":
+			sc.Service, sc.Version = labels["service_name"], labels["revision_name"]
+		case "gae_instance", "gae_app":
+			sc.Service, sc.Version = labels["module_id"], labels["version_id"]
+		case "cloud_function":
+			sc.Service = labels["function_name"]
+		case "k8s_container":
+			sc.Service = labels["container_name"]
+		case "generic_task":
+			sc.Service = labels["job"]
+		}
+		sc.ResourceType = mr.GetType()
+	}
+	if sc.Service == "" {
+		sc.Service = path.Base(os.Args[0])
+	}
+	if eo.Service != "" {
+		sc.Service = eo.Service
+	}
+	if eo.Version != "" {
+		sc.Version = eo.Version
+	}
+	return sc
+}
+
+// allow reports whether the rate limit allows another error event. It is
+// checked before the stack trace of the event is captured.
+func (r *errorReporter) allow() bool {
+	return r.limiter.allow()
+}
+
+// report sends an error event for s, which was exported to projectID with
+// the monitored resource mr. The caller must have checked allow. frames is
+// the stack trace of the span, if any.
+func (r *errorReporter) report(s *trace.SpanData, projectID string, mr *monitoredrespb.MonitoredResource, frames []runtime.Frame) {
+	event := r.errorEvent(s, projectID, frames)
+	event.ServiceContext = errorServiceContext(r.o.ErrorReporting, mr)
+	req := &erpb.ReportErrorEventRequest{
+		ProjectName: "projects/" + projectID,
+		Event:       event,
+	}
+	r.wg.Add(1)
+	go func() {
+		defer r.wg.Done()
+		ctx, cancel := r.o.newContextWithTimeout()
+		defer cancel()
+		if _, err := r.client.ReportErrorEvent(ctx, req); err != nil {
+			r.o.handleError(fmt.Errorf("stackdriver: report error event: %v", err))
+		}
+	}()
+}
+
+// errorEvent returns the error event reporting s. The message consists of
+// the status message, a link to the trace and the stack trace in the format
+// of a Go panic, which Error Reporting uses to group events.
+func (r *errorReporter) errorEvent(s *trace.SpanData, projectID string, frames []runtime.Frame) *erpb.ReportedErrorEvent {
+	msg := s.Status.Message
+	if msg == "" {
+		msg = fmt.Sprintf("%s: status code %d", s.Name, s.Status.Code)
+	}
+	var b strings.Builder
+	fmt.Fprintf(&b, "%s [trace: https://console.cloud.google.com/traces/list?project=%s&tid=%s]\n\ngoroutine 1 [running]:\n",
+		msg, projectID, s.TraceID)
+	for _, f := range frames {
+		fmt.Fprintf(&b, "%s(...)\n\t%s:%d\n", f.Function, f.File, f.Line)
+	}
+
+	event := &erpb.ReportedErrorEvent{
+		Message: b.String(),
+		Context: &erpb.ErrorContext{},
+	}
+	if t, err := ptypes.TimestampProto(s.EndTime); err == nil && !s.EndTime.IsZero() {
+		event.EventTime = t
+	}
+	if len(frames) > 0 {
+		event.Context.ReportLocation = &erpb.SourceLocation{
+			FilePath:     frames[0].File,
+			LineNumber:   int32(frames[0].Line),
+			FunctionName: frames[0].Function,
+		}
+	}
+	return event
+}
+
+// Flush waits for the error events being sent.
+func (r *errorReporter) Flush() {
+	r.wg.Wait()
+}
+
+// rateLimiter is a token bucket allowing rate events per second on average
+// and bursts of up to burst events.
+type rateLimiter struct {
+	mu     sync.Mutex
+	rate   float64
+	burst  float64
+	tokens float64
+	last   time.Time
+	now    func() time.Time
+}
+
+func newRateLimiter(rate float64, burst int) *rateLimiter {
+	return &rateLimiter{
+		rate:   rate,
+		burst:  float64(burst),
+		tokens: float64(burst),
+		now:    time.Now,
+	}
+}
+
+// allow reports whether an event may happen now, and takes a token if so.
+func (l *rateLimiter) allow() bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	now := l.now()
+	if !l.last.IsZero() {
+		l.tokens += now.Sub(l.last).Seconds() * l.rate
+		if l.tokens > l.burst {
+			l.tokens = l.burst
+		}
+	}
+	l.last = now
+	if l.tokens < 1 {
+		return false
+	}
+	l.tokens--
+	return true
+}
+
+// newErrorReportingClient creates the Error Reporting client of the exporter.
+func newErrorReportingClient(o Options) (*errorreporting.ReportErrorsClient, error) {
+	ctx := o.Context
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	client, err := errorreporting.NewReportErrorsClient(ctx, o.ErrorReporting.ClientOptions...)
+	if err != nil {
+		return nil, fmt.Errorf("stackdriver: couldn't initialize error reporting client: %v", err)
+	}
+	return client, nil
+}
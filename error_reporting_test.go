@@ -0,0 +1,227 @@
+// Copyright 2019, OpenCensus Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package stackdriver
+
+import (
+	"context"
+	"net"
+	"os"
+	"path"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"go.opencensus.io/trace"
+	"google.golang.org/api/option"
+	monitoredrespb "google.golang.org/genproto/googleapis/api/monitoredres"
+	erpb "google.golang.org/genproto/googleapis/devtools/clouderrorreporting/v1beta1"
+	tracepb "google.golang.org/genproto/googleapis/devtools/cloudtrace/v2"
+	"google.golang.org/grpc"
+)
+
+type fakeErrorReportingServer struct {
+	erpb.ReportErrorsServiceServer
+	mu   sync.Mutex
+	reqs []*erpb.ReportErrorEventRequest
+}
+
+func (s *fakeErrorReportingServer) ReportErrorEvent(ctx context.Context, req *erpb.ReportErrorEventRequest) (*erpb.ReportErrorEventResponse, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.reqs = append(s.reqs, req)
+	return &erpb.ReportErrorEventResponse{}, nil
+}
+
+func TestErrorReporting(t *testing.T) {
+	ln, err := net.Listen("tcp", ":0")
+	if err != nil {
+		t.Fatalf("Failed to bind to an available address: %v", err)
+	}
+	server := new(fakeErrorReportingServer)
+	srv := grpc.NewServer()
+	erpb.RegisterReportErrorsServiceServer(srv, server)
+	go func() {
+		_ = srv.Serve(ln)
+	}()
+	defer srv.Stop()
+
+	conn, err := grpc.Dial(ln.Addr().String(), grpc.WithInsecure())
+	if err != nil {
+		t.Fatalf("Failed to make a gRPC connection: %v", err)
+	}
+	defer conn.Close()
+
+	o := Options{
+		ProjectID: "proj",
+		Resource: &monitoredrespb.MonitoredResource{
+			Type:   "cloud_run_revision",
+			Labels: map[string]string{"service_name": "checkout", "revision_name": "checkout-00042"},
+		},
+		ErrorReporting: &ErrorReportingOptions{
+			ClientOptions: []option.ClientOption{option.WithGRPCConn(conn)},
+			Burst:         2,
+		},
+	}
+	client, err := newErrorReportingClient(o)
+	if err != nil {
+		t.Fatal(err)
+	}
+	e := newTraceExporterWithClient(o, nil)
+	e.uploadFn = func(spans []*tracepb.Span) {}
+	e.errorReporter = newErrorReporter(o, client)
+
+	failed := &trace.SpanData{
+		SpanContext: trace.SpanContext{TraceID: trace.TraceID{1}},
+		Name:        "charge",
+		Status:      trace.Status{Code: trace.StatusCodeInternal, Message: "card declined"},
+		EndTime:     time.Now(),
+	}
+	e.ExportSpan(&trace.SpanData{Name: "ok"})
+	for i := 0; i < 3; i++ {
+		e.ExportSpan(failed)
+	}
+	e.Flush()
+
+	server.mu.Lock()
+	defer server.mu.Unlock()
+	if len(server.reqs) != 2 {
+		t.Fatalf("got %d error events; want 2 (rate limited)", len(server.reqs))
+	}
+	req := server.reqs[0]
+	if got, want := req.ProjectName, "projects/proj"; got != want {
+		t.Errorf("ProjectName = %q; want %q", got, want)
+	}
+	sc := req.Event.ServiceContext
+	if sc.Service != "checkout" || sc.Version != "checkout-00042" || sc.ResourceType != "cloud_run_revision" {
+		t.Errorf("ServiceContext = %v; want checkout/checkout-00042 on cloud_run_revision", sc)
+	}
+	msg := req.Event.Message
+	for _, want := range []string{
+		"card declined",
+		"tid=" + trace.TraceID{1}.String(),
+		"goroutine 1 [running]:",
+		"TestErrorReporting",
+	} {
+		if !strings.Contains(msg, want) {
+			t.Errorf("Message does not contain %q:\n%s", want, msg)
+		}
+	}
+	if fn := req.Event.Context.GetReportLocation().GetFunctionName(); !strings.HasSuffix(fn, "TestErrorReporting") {
+		t.Errorf("ReportLocation.FunctionName = %q; want TestErrorReporting", fn)
+	}
+}
+
+func TestErrorReportingSpanResourceAndDrops(t *testing.T) {
+	ln, err := net.Listen("tcp", ":0")
+	if err != nil {
+		t.Fatalf("Failed to bind to an available address: %v", err)
+	}
+	server := new(fakeErrorReportingServer)
+	srv := grpc.NewServer()
+	erpb.RegisterReportErrorsServiceServer(srv, server)
+	go func() {
+		_ = srv.Serve(ln)
+	}()
+	defer srv.Stop()
+
+	conn, err := grpc.Dial(ln.Addr().String(), grpc.WithInsecure())
+	if err != nil {
+		t.Fatalf("Failed to make a gRPC connection: %v", err)
+	}
+	defer conn.Close()
+
+	o := Options{
+		ProjectID: "proj",
+		Resource:  &monitoredrespb.MonitoredResource{Type: "global"},
+		SpanResource: SpanResourceOptions{
+			GetResource: func(s *trace.SpanData) *monitoredrespb.MonitoredResource {
+				return &monitoredrespb.MonitoredResource{
+					Type:   "k8s_container",
+					Labels: map[string]string{"container_name": s.Name},
+				}
+			},
+		},
+		ErrorReporting: &ErrorReportingOptions{
+			ClientOptions: []option.ClientOption{option.WithGRPCConn(conn)},
+		},
+	}
+	client, err := newErrorReportingClient(o)
+	if err != nil {
+		t.Fatal(err)
+	}
+	e := newTraceExporterWithClient(o, nil)
+	e.uploadFn = func(spans []*tracepb.Span) {}
+	e.errorReporter = newErrorReporter(o, client)
+
+	status := trace.Status{Code: trace.StatusCodeInternal, Message: "failed"}
+	e.ExportSpan(&trace.SpanData{Name: "cart", Status: status})
+	// A span that doesn't fit in a request is dropped and not reported.
+	e.maxSpanBytes = 10
+	e.ExportSpan(&trace.SpanData{Name: "dropped", Status: status})
+	e.Flush()
+
+	server.mu.Lock()
+	defer server.mu.Unlock()
+	if len(server.reqs) != 1 {
+		t.Fatalf("got %d error events; want 1", len(server.reqs))
+	}
+	sc := server.reqs[0].Event.ServiceContext
+	if sc.Service != "cart" || sc.ResourceType != "k8s_container" {
+		t.Errorf("ServiceContext = %v; want cart on k8s_container", sc)
+	}
+}
+
+func TestRateLimiter(t *testing.T) {
+	now := time.Unix(0, 0)
+	l := newRateLimiter(2, 1)
+	l.now = func() time.Time { return now }
+	if !l.allow() {
+		t.Fatal("first event not allowed")
+	}
+	if l.allow() {
+		t.Fatal("event beyond burst allowed")
+	}
+	now = now.Add(500 * time.Millisecond)
+	if !l.allow() {
+		t.Fatal("event after refill not allowed")
+	}
+}
+
+func TestErrorServiceContext(t *testing.T) {
+	for _, tt := range []struct {
+		mr                    *monitoredrespb.MonitoredResource
+		wantService, wantVers string
+	}{
+		{
+			mr:          &monitoredrespb.MonitoredResource{Type: "gae_instance", Labels: map[string]string{"module_id": "default", "version_id": "v1"}},
+			wantService: "default",
+			wantVers:    "v1",
+		},
+		{
+			mr:          &monitoredrespb.MonitoredResource{Type: "cloud_function", Labels: map[string]string{"function_name": "hello"}},
+			wantService: "hello",
+		},
+		{
+			mr:          &monitoredrespb.MonitoredResource{Type: "global"},
+			wantService: path.Base(os.Args[0]),
+		},
+	} {
+		sc := errorServiceContext(&ErrorReportingOptions{}, tt.mr)
+		if sc.Service != tt.wantService || sc.Version != tt.wantVers || sc.ResourceType != tt.mr.Type {
+			t.Errorf("errorServiceContext(%v) = %v; want %s/%s on %s", tt.mr, sc, tt.wantService, tt.wantVers, tt.mr.Type)
+		}
+	}
+}
@@ -0,0 +1,91 @@
+// Copyright 2019, OpenCensus Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package gcpenv reads the environment variables set by the serverless
+// platforms of Google Cloud. It is shared by the exporter and the
+// monitoredresource package so that both detect the same platform.
+package gcpenv
+
+import "os"
+
+// Serverless describes the serverless platform the application runs on.
+// At most one of FunctionName, GAEService and RunService is set.
+type Serverless struct {
+	// FunctionName is the name of the Cloud Function.
+	FunctionName string
+	// FunctionRegion is the region of the Cloud Function. Only older
+	// runtimes set it.
+	FunctionRegion string
+
+	// GAEService, GAEVersion and GAEInstance describe the App Engine
+	// instance.
+	GAEService  string
+	GAEVersion  string
+	GAEInstance string
+
+	// RunService, RunRevision and RunConfiguration describe the Cloud Run
+	// revision.
+	RunService       string
+	RunRevision      string
+	RunConfiguration string
+}
+
+// DetectServerless reads the serverless platform from the environment.
+//
+// Cloud Functions set FUNCTION_TARGET and, depending on the runtime, either
+// K_SERVICE or FUNCTION_NAME and FUNCTION_REGION. The function name is the
+// first of K_SERVICE, FUNCTION_NAME and FUNCTION_TARGET that is set. For
+// details refer to:
+// https://cloud.google.com/functions/docs/env-var#runtime_environment_variables_set_automatically
+//
+// App Engine sets GAE_SERVICE, GAE_VERSION and GAE_INSTANCE. For details
+// refer to:
+// https://cloud.google.com/appengine/docs/standard/go112/runtime#environment_variables
+//
+// Cloud Run sets K_SERVICE, K_REVISION and K_CONFIGURATION. For details
+// refer to:
+// https://cloud.google.com/run/docs/reference/container-contract#env-vars
+func DetectServerless() Serverless {
+	if target := os.Getenv("FUNCTION_TARGET"); target != "" {
+		return Serverless{
+			FunctionName:   FirstOf(os.Getenv("K_SERVICE"), os.Getenv("FUNCTION_NAME"), target),
+			FunctionRegion: os.Getenv("FUNCTION_REGION"),
+		}
+	}
+	if service := os.Getenv("GAE_SERVICE"); service != "" {
+		return Serverless{
+			GAEService:  service,
+			GAEVersion:  os.Getenv("GAE_VERSION"),
+			GAEInstance: os.Getenv("GAE_INSTANCE"),
+		}
+	}
+	if service := os.Getenv("K_SERVICE"); service != "" {
+		return Serverless{
+			RunService:       service,
+			RunRevision:      os.Getenv("K_REVISION"),
+			RunConfiguration: os.Getenv("K_CONFIGURATION"),
+		}
+	}
+	return Serverless{}
+}
+
+// FirstOf returns the first non-empty value.
+func FirstOf(values ...string) string {
+	for _, v := range values {
+		if v != "" {
+			return v
+		}
+	}
+	return ""
+}
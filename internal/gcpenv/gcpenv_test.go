@@ -0,0 +1,91 @@
+// Copyright 2019, OpenCensus Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package gcpenv
+
+import (
+	"os"
+	"testing"
+)
+
+var serverlessEnv = []string{
+	"FUNCTION_TARGET", "FUNCTION_NAME", "FUNCTION_REGION",
+	"GAE_SERVICE", "GAE_VERSION", "GAE_INSTANCE",
+	"K_SERVICE", "K_REVISION", "K_CONFIGURATION",
+}
+
+// setEnv sets the serverless environment variables to env, unsetting the
+// others, and returns a function restoring them.
+func setEnv(env map[string]string) func() {
+	old := make(map[string]string)
+	for _, k := range serverlessEnv {
+		old[k] = os.Getenv(k)
+		os.Setenv(k, env[k])
+	}
+	return func() {
+		for k, v := range old {
+			os.Setenv(k, v)
+		}
+	}
+}
+
+func TestDetectServerless(t *testing.T) {
+	tests := []struct {
+		name string
+		env  map[string]string
+		want Serverless
+	}{
+		{
+			name: "none",
+		},
+		{
+			name: "Cloud Functions newer runtimes",
+			env:  map[string]string{"FUNCTION_TARGET": "Hello", "K_SERVICE": "hello", "K_REVISION": "1"},
+			want: Serverless{FunctionName: "hello"},
+		},
+		{
+			name: "Cloud Functions older runtimes",
+			env:  map[string]string{"FUNCTION_TARGET": "Hello", "FUNCTION_NAME": "hello", "FUNCTION_REGION": "europe-west1"},
+			want: Serverless{FunctionName: "hello", FunctionRegion: "europe-west1"},
+		},
+		{
+			name: "Cloud Functions K_SERVICE before FUNCTION_NAME",
+			env:  map[string]string{"FUNCTION_TARGET": "Hello", "K_SERVICE": "service", "FUNCTION_NAME": "name"},
+			want: Serverless{FunctionName: "service"},
+		},
+		{
+			name: "Cloud Functions target only",
+			env:  map[string]string{"FUNCTION_TARGET": "Hello"},
+			want: Serverless{FunctionName: "Hello"},
+		},
+		{
+			name: "App Engine",
+			env:  map[string]string{"GAE_SERVICE": "default", "GAE_VERSION": "v1", "GAE_INSTANCE": "i1", "K_SERVICE": "ignored"},
+			want: Serverless{GAEService: "default", GAEVersion: "v1", GAEInstance: "i1"},
+		},
+		{
+			name: "Cloud Run",
+			env:  map[string]string{"K_SERVICE": "run", "K_REVISION": "run-1", "K_CONFIGURATION": "run"},
+			want: Serverless{RunService: "run", RunRevision: "run-1", RunConfiguration: "run"},
+		},
+	}
+	for _, tt := range tests {
+		restore := setEnv(tt.env)
+		got := DetectServerless()
+		restore()
+		if got != tt.want {
+			t.Errorf("%s: DetectServerless() = %+v; want %+v", tt.name, got, tt.want)
+		}
+	}
+}
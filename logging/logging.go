@@ -0,0 +1,170 @@
+// Copyright 2019, OpenCensus Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package logging correlates log entries with the traces exported to
+// Stackdriver Trace, so that Cloud Logging shows them nested under their
+// spans.
+//
+// The Cloud Logging agents of GKE, Cloud Run, App Engine and Cloud Functions
+// parse JSON log lines written to stdout and read the trace, span ID and
+// sampling decision from well-known fields. Logger writes such lines:
+//
+//	logger := logging.NewLogger(exporter.ProjectID(), os.Stdout)
+//	logger.Log(ctx, logging.Info, "handled request", nil)
+//
+// Code using the standard log package can obtain a *log.Logger bound to the
+// span in a context with Logger.StdLogger.
+package logging // import "contrib.go.opencensus.io/exporter/stackdriver/logging"
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"sync"
+	"time"
+
+	"go.opencensus.io/trace"
+)
+
+// Keys of the structured log fields read by Cloud Logging.
+const (
+	TraceKey        = "logging.googleapis.com/trace"
+	SpanIDKey       = "logging.googleapis.com/spanId"
+	TraceSampledKey = "logging.googleapis.com/trace_sampled"
+
+	severityKey = "severity"
+	messageKey  = "message"
+	timeKey     = "time"
+)
+
+// Severity is the severity of a log entry.
+type Severity string
+
+// Severities understood by Cloud Logging.
+const (
+	Default  Severity = "DEFAULT"
+	Debug    Severity = "DEBUG"
+	Info     Severity = "INFO"
+	Warning  Severity = "WARNING"
+	Error    Severity = "ERROR"
+	Critical Severity = "CRITICAL"
+)
+
+// TraceName returns the resource name of the trace of sc in the project,
+// as used by Stackdriver Trace and Cloud Logging.
+func TraceName(projectID string, sc trace.SpanContext) string {
+	return fmt.Sprintf("projects/%s/traces/%s", projectID, sc.TraceID.String())
+}
+
+// Fields returns the structured log fields that correlate a log entry with
+// the span of sc in the project.
+func Fields(projectID string, sc trace.SpanContext) map[string]interface{} {
+	return map[string]interface{}{
+		TraceKey:        TraceName(projectID, sc),
+		SpanIDKey:       sc.SpanID.String(),
+		TraceSampledKey: sc.IsSampled(),
+	}
+}
+
+// FieldsFromContext returns the fields correlating a log entry with the span
+// in ctx, or nil if ctx has no span.
+func FieldsFromContext(ctx context.Context, projectID string) map[string]interface{} {
+	span := trace.FromContext(ctx)
+	if span == nil {
+		return nil
+	}
+	return Fields(projectID, span.SpanContext())
+}
+
+// Logger writes structured JSON log entries, one per line, correlated with
+// the spans in the contexts passed to it. It is safe for concurrent use.
+type Logger struct {
+	projectID string
+
+	mu sync.Mutex
+	w  io.Writer
+
+	now func() time.Time
+}
+
+// NewLogger returns a Logger writing to w, typically os.Stdout. projectID
+// must be the project traces are exported to, e.g. Exporter.ProjectID.
+func NewLogger(projectID string, w io.Writer) *Logger {
+	return &Logger{
+		projectID: projectID,
+		w:         w,
+		now:       time.Now,
+	}
+}
+
+// Log writes an entry with the given severity, message and additional
+// fields, correlated with the span in ctx.
+func (l *Logger) Log(ctx context.Context, severity Severity, message string, fields map[string]interface{}) error {
+	entry := make(map[string]interface{}, len(fields)+6)
+	for k, v := range fields {
+		entry[k] = v
+	}
+	for k, v := range FieldsFromContext(ctx, l.projectID) {
+		entry[k] = v
+	}
+	entry[severityKey] = severity
+	entry[messageKey] = message
+	entry[timeKey] = l.now().Format(time.RFC3339Nano)
+
+	b, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+	b = append(b, '\n')
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	_, err = l.w.Write(b)
+	return err
+}
+
+// Logf is like Log without additional fields and with a formatted message.
+func (l *Logger) Logf(ctx context.Context, severity Severity, format string, args ...interface{}) error {
+	return l.Log(ctx, severity, fmt.Sprintf(format, args...), nil)
+}
+
+// Writer returns an io.Writer that logs each write as one entry with the
+// given severity, correlated with the span in ctx.
+func (l *Logger) Writer(ctx context.Context, severity Severity) io.Writer {
+	return &entryWriter{ctx: ctx, severity: severity, l: l}
+}
+
+// StdLogger returns a standard library logger whose output is logged with
+// the given severity and correlated with the span in ctx. The flags of the
+// returned logger are 0, as entries carry their own timestamp.
+func (l *Logger) StdLogger(ctx context.Context, severity Severity) *log.Logger {
+	return log.New(l.Writer(ctx, severity), "", 0)
+}
+
+type entryWriter struct {
+	ctx      context.Context
+	severity Severity
+	l        *Logger
+}
+
+func (w *entryWriter) Write(p []byte) (int, error) {
+	msg := string(bytes.TrimSuffix(p, []byte("\n")))
+	if err := w.l.Log(w.ctx, w.severity, msg, nil); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
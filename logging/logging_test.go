@@ -0,0 +1,99 @@
+// Copyright 2019, OpenCensus Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package logging
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"go.opencensus.io/trace"
+)
+
+func TestLogger(t *testing.T) {
+	ctx, span := trace.StartSpan(context.Background(), "request", trace.WithSampler(trace.AlwaysSample()))
+	defer span.End()
+	sc := span.SpanContext()
+
+	var buf bytes.Buffer
+	l := NewLogger("my-project", &buf)
+	l.now = func() time.Time { return time.Date(2019, 7, 1, 12, 0, 0, 0, time.UTC) }
+
+	if err := l.Log(ctx, Warning, "slow request", map[string]interface{}{"latency_ms": 1200}); err != nil {
+		t.Fatal(err)
+	}
+	l.StdLogger(ctx, Info).Printf("handled %s", "/users")
+	if err := l.Logf(context.Background(), Error, "no span"); err != nil {
+		t.Fatal(err)
+	}
+
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if len(lines) != 3 {
+		t.Fatalf("got %d lines; want 3:\n%s", len(lines), buf.String())
+	}
+	want := []map[string]interface{}{
+		{
+			"severity":      "WARNING",
+			"message":       "slow request",
+			"time":          "2019-07-01T12:00:00Z",
+			"latency_ms":    float64(1200),
+			TraceKey:        "projects/my-project/traces/" + sc.TraceID.String(),
+			SpanIDKey:       sc.SpanID.String(),
+			TraceSampledKey: true,
+		},
+		{
+			"severity":      "INFO",
+			"message":       "handled /users",
+			"time":          "2019-07-01T12:00:00Z",
+			TraceKey:        "projects/my-project/traces/" + sc.TraceID.String(),
+			SpanIDKey:       sc.SpanID.String(),
+			TraceSampledKey: true,
+		},
+		{
+			"severity": "ERROR",
+			"message":  "no span",
+			"time":     "2019-07-01T12:00:00Z",
+		},
+	}
+	for i, line := range lines {
+		var got map[string]interface{}
+		if err := json.Unmarshal([]byte(line), &got); err != nil {
+			t.Fatalf("line %d: %v", i, err)
+		}
+		if !reflect.DeepEqual(got, want[i]) {
+			t.Errorf("line %d = %v; want %v", i, got, want[i])
+		}
+	}
+}
+
+func TestFields(t *testing.T) {
+	sc := trace.SpanContext{
+		TraceID: trace.TraceID{0x01, 0x02},
+		SpanID:  trace.SpanID{0x0a},
+	}
+	got := Fields("p", sc)
+	want := map[string]interface{}{
+		TraceKey:        "projects/p/traces/01020000000000000000000000000000",
+		SpanIDKey:       "0a00000000000000",
+		TraceSampledKey: false,
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Fields() = %v; want %v", got, want)
+	}
+}
@@ -0,0 +1,136 @@
+// Copyright 2019, OpenCensus Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package stackdriver
+
+import (
+	"go.opencensus.io/metric/metricdata"
+	"go.opencensus.io/resource"
+	"go.opencensus.io/stats"
+	"go.opencensus.io/stats/view"
+	"go.opencensus.io/tag"
+	monitoredrespb "google.golang.org/genproto/googleapis/api/monitoredres"
+
+	metricspb "github.com/census-instrumentation/opencensus-proto/gen-go/metrics/v1"
+)
+
+// MetricResourceInput describes a time series passed to
+// Options.GetMetricResource.
+type MetricResourceInput struct {
+	// Descriptor describes the metric of the time series. For views, its
+	// name is the view name and its label keys are the tag keys of the view.
+	Descriptor *metricdata.Descriptor
+
+	// Labels holds the labels of the time series, by label key. Labels
+	// without a value are left out. The default monitoring labels are not
+	// included.
+	Labels map[string]string
+
+	// Resource is the OpenCensus resource of the metric. For views, it is
+	// the resource returned by Options.ResourceDetector. It is nil if there
+	// is none.
+	Resource *resource.Resource
+}
+
+// selectMetricResource calls Options.GetMetricResource for a time series
+// with the given labels. It returns the labels of the time series, including
+// the default labels, and its validated monitored resource, or a nil resource
+// if GetMetricResource leaves the choice to the exporter.
+func (se *statsExporter) selectMetricResource(md *metricdata.Descriptor, labels map[string]string, res *resource.Resource, defaults map[string]labelValue) (map[string]string, *monitoredrespb.MonitoredResource) {
+	newLabels, mr := se.o.GetMetricResource(MetricResourceInput{
+		Descriptor: md,
+		Labels:     labels,
+		Resource:   res,
+	})
+	tsLabels := make(map[string]string, len(defaults)+len(newLabels))
+	for k, lbl := range defaults {
+		tsLabels[sanitize(k)] = lbl.val
+	}
+	for k, v := range newLabels {
+		tsLabels[sanitize(k)] = v
+	}
+	if mr == nil {
+		return tsLabels, nil
+	}
+	return tsLabels, se.resources.validate(mr)
+}
+
+// viewDescriptor returns the metric descriptor of the time series of v.
+func viewDescriptor(v *view.View) *metricdata.Descriptor {
+	md := &metricdata.Descriptor{
+		Name:        v.Name,
+		Description: v.Description,
+		Unit:        metricdata.Unit(v.Measure.Unit()),
+		LabelKeys:   make([]metricdata.LabelKey, 0, len(v.TagKeys)),
+	}
+	_, isInt := v.Measure.(*stats.Int64Measure)
+	switch v.Aggregation.Type {
+	case view.AggTypeCount:
+		md.Type = metricdata.TypeCumulativeInt64
+		md.Unit = metricdata.UnitDimensionless
+	case view.AggTypeSum:
+		md.Type = metricdata.TypeCumulativeFloat64
+		if isInt {
+			md.Type = metricdata.TypeCumulativeInt64
+		}
+	case view.AggTypeDistribution:
+		md.Type = metricdata.TypeCumulativeDistribution
+	case view.AggTypeLastValue:
+		md.Type = metricdata.TypeGaugeFloat64
+		if isInt {
+			md.Type = metricdata.TypeGaugeInt64
+		}
+	}
+	for _, k := range v.TagKeys {
+		md.LabelKeys = append(md.LabelKeys, metricdata.LabelKey{Key: k.Name()})
+	}
+	return md
+}
+
+// tagLabels returns the labels of a view row.
+func tagLabels(tags []tag.Tag) map[string]string {
+	labels := make(map[string]string, len(tags))
+	for _, t := range tags {
+		labels[t.Key.Name()] = t.Value
+	}
+	return labels
+}
+
+// protoDescriptorTypes maps the types of proto metric descriptors to
+// metricdata types.
+var protoDescriptorTypes = map[metricspb.MetricDescriptor_Type]metricdata.Type{
+	metricspb.MetricDescriptor_GAUGE_INT64:             metricdata.TypeGaugeInt64,
+	metricspb.MetricDescriptor_GAUGE_DOUBLE:            metricdata.TypeGaugeFloat64,
+	metricspb.MetricDescriptor_GAUGE_DISTRIBUTION:      metricdata.TypeGaugeDistribution,
+	metricspb.MetricDescriptor_CUMULATIVE_INT64:        metricdata.TypeCumulativeInt64,
+	metricspb.MetricDescriptor_CUMULATIVE_DOUBLE:       metricdata.TypeCumulativeFloat64,
+	metricspb.MetricDescriptor_CUMULATIVE_DISTRIBUTION: metricdata.TypeCumulativeDistribution,
+	metricspb.MetricDescriptor_SUMMARY:                 metricdata.TypeSummary,
+}
+
+// protoDescriptor returns the metricdata form of the descriptor of metric.
+func protoDescriptor(metric *metricspb.Metric) *metricdata.Descriptor {
+	pmd := metric.GetMetricDescriptor()
+	md := &metricdata.Descriptor{
+		Name:        pmd.GetName(),
+		Description: pmd.GetDescription(),
+		Unit:        metricdata.Unit(pmd.GetUnit()),
+		Type:        protoDescriptorTypes[pmd.GetType()],
+		LabelKeys:   make([]metricdata.LabelKey, 0, len(pmd.GetLabelKeys())),
+	}
+	for _, k := range pmd.GetLabelKeys() {
+		md.LabelKeys = append(md.LabelKeys, metricdata.LabelKey{Key: k.GetKey(), Description: k.GetDescription()})
+	}
+	return md
+}
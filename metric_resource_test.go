@@ -0,0 +1,200 @@
+// Copyright 2019, OpenCensus Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package stackdriver
+
+import (
+	"context"
+	"reflect"
+	"testing"
+	"time"
+
+	metricspb "github.com/census-instrumentation/opencensus-proto/gen-go/metrics/v1"
+	resourcepb "github.com/census-instrumentation/opencensus-proto/gen-go/resource/v1"
+	"go.opencensus.io/metric/metricdata"
+	"go.opencensus.io/resource"
+	"go.opencensus.io/stats"
+	"go.opencensus.io/stats/view"
+	"go.opencensus.io/tag"
+	monitoredrespb "google.golang.org/genproto/googleapis/api/monitoredres"
+	monitoringpb "google.golang.org/genproto/googleapis/monitoring/v3"
+)
+
+// podResource moves the pod label of time series that have one to the
+// pod_name label of a k8s_container resource.
+func podResource(got *[]MetricResourceInput) func(MetricResourceInput) (map[string]string, *monitoredrespb.MonitoredResource) {
+	return func(in MetricResourceInput) (map[string]string, *monitoredrespb.MonitoredResource) {
+		*got = append(*got, in)
+		pod, ok := in.Labels["pod"]
+		if !ok {
+			return in.Labels, nil
+		}
+		labels := make(map[string]string)
+		for k, v := range in.Labels {
+			if k != "pod" {
+				labels[k] = v
+			}
+		}
+		return labels, &monitoredrespb.MonitoredResource{
+			Type: "k8s_container",
+			Labels: map[string]string{
+				"location":       "us-central1-a",
+				"cluster_name":   "cluster1",
+				"namespace_name": "default",
+				"pod_name":       pod,
+				"container_name": "app",
+			},
+		}
+	}
+}
+
+func checkMetricResources(t *testing.T, path, fallback string, tss []*monitoringpb.TimeSeries) {
+	t.Helper()
+	if len(tss) != 2 {
+		t.Fatalf("%s: got %d time series; want 2", path, len(tss))
+	}
+	if got, want := tss[0].Metric.Labels, map[string]string{"method": "get"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("%s: labels = %v; want %v", path, got, want)
+	}
+	if got := tss[0].Resource; got.Type != "k8s_container" || got.Labels["pod_name"] != "pod1" {
+		t.Errorf("%s: resource = %v; want k8s_container of pod1", path, got)
+	}
+	if got := tss[1].Resource; got.Type != fallback {
+		t.Errorf("%s: resource of time series without pod = %v; want %s", path, got, fallback)
+	}
+	if got, want := tss[1].Metric.Labels, map[string]string{"method": "put"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("%s: labels = %v; want %v", path, got, want)
+	}
+}
+
+func TestGetMetricResource(t *testing.T) {
+	var inputs []MetricResourceInput
+	o := Options{
+		ProjectID:               "proj1",
+		DefaultMonitoringLabels: &Labels{},
+		MonitoringClientOptions: authOptions,
+		GetMetricResource:       podResource(&inputs),
+	}
+	se, err := newStatsExporter(o)
+	if err != nil {
+		t.Fatal(err)
+	}
+	start := time.Unix(1000, 0)
+
+	// Views.
+	m := stats.Int64("requests", "", stats.UnitDimensionless)
+	method, _ := tag.NewKey("method")
+	pod, _ := tag.NewKey("pod")
+	v := &view.View{Name: "requests", Measure: m, TagKeys: []tag.Key{method, pod}, Aggregation: view.Count()}
+	vd := &view.Data{
+		View:  v,
+		Start: start,
+		End:   start.Add(time.Minute),
+		Rows: []*view.Row{
+			{Tags: []tag.Tag{{Key: method, Value: "get"}, {Key: pod, Value: "pod1"}}, Data: &view.CountData{Value: 1}},
+			{Tags: []tag.Tag{{Key: method, Value: "put"}}, Data: &view.CountData{Value: 1}},
+		},
+	}
+	reqs := se.makeReq([]*view.Data{vd}, maxTimeSeriesPerUpload)
+	if len(reqs) != 1 {
+		t.Fatalf("got %d requests; want 1", len(reqs))
+	}
+	checkMetricResources(t, "views", "global", reqs[0].TimeSeries)
+	if md := inputs[0].Descriptor; md.Name != "requests" || md.Type != metricdata.TypeCumulativeInt64 || len(md.LabelKeys) != 2 {
+		t.Errorf("view descriptor = %+v", md)
+	}
+
+	// Metrics.
+	inputs = nil
+	metric := &metricdata.Metric{
+		Descriptor: metricdata.Descriptor{
+			Name:      "requests",
+			Type:      metricdata.TypeCumulativeInt64,
+			LabelKeys: []metricdata.LabelKey{{Key: "method"}, {Key: "pod"}},
+		},
+		Resource: &resource.Resource{Type: "k8s"},
+		TimeSeries: []*metricdata.TimeSeries{
+			{
+				LabelValues: []metricdata.LabelValue{metricdata.NewLabelValue("get"), metricdata.NewLabelValue("pod1")},
+				Points:      []metricdata.Point{metricdata.NewInt64Point(start.Add(time.Minute), 1)},
+				StartTime:   start,
+			},
+			{
+				LabelValues: []metricdata.LabelValue{metricdata.NewLabelValue("put"), {}},
+				Points:      []metricdata.Point{metricdata.NewInt64Point(start.Add(time.Minute), 1)},
+				StartTime:   start,
+			},
+		},
+	}
+	tss, err := se.metricToMpbTs(context.Background(), metric)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The resource of the metric is kept when GetMetricResource returns nil.
+	checkMetricResources(t, "metrics", "k8s", tss)
+	if inputs[0].Resource != metric.Resource {
+		t.Errorf("metric resource = %v; want %v", inputs[0].Resource, metric.Resource)
+	}
+
+	// Metrics protos.
+	inputs = nil
+	metricPb := &metricspb.Metric{
+		MetricDescriptor: &metricspb.MetricDescriptor{
+			Name:      "requests",
+			Type:      metricspb.MetricDescriptor_CUMULATIVE_INT64,
+			LabelKeys: []*metricspb.LabelKey{{Key: "method"}, {Key: "pod"}},
+		},
+		Timeseries: []*metricspb.TimeSeries{
+			{
+				LabelValues: []*metricspb.LabelValue{{Value: "get", HasValue: true}, {Value: "pod1", HasValue: true}},
+				Points:      []*metricspb.Point{{Value: &metricspb.Point_Int64Value{Int64Value: 1}}},
+			},
+			{
+				LabelValues: []*metricspb.LabelValue{{Value: "put", HasValue: true}, {}},
+				Points:      []*metricspb.Point{{Value: &metricspb.Point_Int64Value{Int64Value: 1}}},
+			},
+		},
+	}
+	rsc := &resourcepb.Resource{Type: "node", Labels: map[string]string{"zone": "z1"}}
+	tss, err = se.protoMetricToTimeSeries(context.Background(), nil, rsc, &monitoredrespb.MonitoredResource{Type: "global"}, metricPb, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkMetricResources(t, "metrics protos", "global", tss)
+	if md := inputs[0].Descriptor; md.Type != metricdata.TypeCumulativeInt64 || len(md.LabelKeys) != 2 {
+		t.Errorf("proto descriptor = %+v", md)
+	}
+	if res := inputs[0].Resource; res == nil || res.Type != "node" || res.Labels["zone"] != "z1" {
+		t.Errorf("proto resource = %v; want node in z1", res)
+	}
+}
+
+func TestGetMetricResourceValidated(t *testing.T) {
+	var errs []error
+	o := Options{
+		ProjectID: "proj1",
+		OnError:   func(err error) { errs = append(errs, err) },
+		GetMetricResource: func(in MetricResourceInput) (map[string]string, *monitoredrespb.MonitoredResource) {
+			return in.Labels, &monitoredrespb.MonitoredResource{Type: "k8s_container", Labels: map[string]string{"pod_name": in.Labels["pod"]}}
+		},
+	}
+	se := &statsExporter{o: o, resources: newResourceValidator(o)}
+	labels, mr := se.selectMetricResource(&metricdata.Descriptor{Name: "m"}, map[string]string{"pod": "pod1"}, nil, map[string]labelValue{"opencensus_task": {val: "task"}})
+	if mr.Type != "global" || len(errs) != 1 {
+		t.Errorf("selectMetricResource() = %v with %d errors; want global and 1 error", mr, len(errs))
+	}
+	if want := map[string]string{"pod": "pod1", "opencensus_task": "task"}; !reflect.DeepEqual(labels, want) {
+		t.Errorf("labels = %v; want %v", labels, want)
+	}
+}
@@ -57,8 +57,9 @@ func (se *statsExporter) ExportMetrics(ctx context.Context, metrics []*metricdat
 		return nil
 	}
 
+	_, _, metricsBundler := se.bundlers()
 	for _, metric := range metrics {
-		se.metricsBundler.Add(metric, 1)
+		metricsBundler.Add(metric, 1)
 		// TODO: [rghetia] handle errors.
 	}
 
@@ -92,6 +93,17 @@ func (se *statsExporter) uploadMetrics(metrics []*metricdata.Metric) error {
 		}
 	}
 
+	// Descriptors for the projects that time series are routed to.
+	var mds map[string]*googlemetricpb.MetricDescriptor
+	if se.o.GetTimeSeriesProjectID != nil {
+		mds = make(map[string]*googlemetricpb.MetricDescriptor)
+		for _, metric := range metrics {
+			if md, err := se.metricToMpbMetricDescriptor(metric); err == nil {
+				mds[md.Type] = md
+			}
+		}
+	}
+
 	var allTimeSeries []*monitoringpb.TimeSeries
 	for _, metric := range metrics {
 		tsl, err := se.metricToMpbTs(ctx, metric)
@@ -113,6 +125,12 @@ func (se *statsExporter) uploadMetrics(metrics []*metricdata.Metric) error {
 		}
 		batch := allTimeSeries[start:end]
 		ctsreql := se.combineTimeSeriesToCreateTimeSeriesRequest(batch)
+		if mds != nil {
+			if err := se.createRoutedMetricDescriptors(ctx, ctsreql, mds); err != nil {
+				span.SetStatus(trace.Status{Code: trace.StatusCodeUnknown, Message: err.Error()})
+				return err
+			}
+		}
 		for _, ctsreq := range ctsreql {
 			if err := createTimeSeries(ctx, se.c, ctsreq); err != nil {
 				span.SetStatus(trace.Status{Code: trace.StatusCodeUnknown, Message: err.Error()})
@@ -144,6 +162,7 @@ func (se *statsExporter) metricToMpbTs(ctx context.Context, metric *metricdata.M
 		return nil, nil
 	}
 
+	defaultLabels := se.labels()
 	timeSeries := make([]*monitoringpb.TimeSeries, 0, len(metric.TimeSeries))
 	for _, ts := range metric.TimeSeries {
 		sdPoints, err := se.metricTsToMpbPoint(ts, metricKind)
@@ -154,17 +173,25 @@ func (se *statsExporter) metricToMpbTs(ctx context.Context, metric *metricdata.M
 
 		// Each TimeSeries has labelValues which MUST be correlated
 		// with that from the MetricDescriptor
-		labels, err := metricLabelsToTsLabels(se.defaultLabels, metricLabelKeys, ts.LabelValues)
+		labels, err := metricLabelsToTsLabels(defaultLabels, metricLabelKeys, ts.LabelValues)
 		if err != nil {
 			// TODO: (@rghetia) perhaps log this error from labels extraction, if non-nil.
 			continue
 		}
+		tsResource := resource
+		if se.o.GetMetricResource != nil {
+			var mr *monitoredrespb.MonitoredResource
+			labels, mr = se.selectMetricResource(&metric.Descriptor, metricValueLabels(metricLabelKeys, ts.LabelValues), metric.Resource, defaultLabels)
+			if mr != nil {
+				tsResource = mr
+			}
+		}
 		timeSeries = append(timeSeries, &monitoringpb.TimeSeries{
 			Metric: &googlemetricpb.Metric{
 				Type:   metricType,
 				Labels: labels,
 			},
-			Resource: resource,
+			Resource: tsResource,
 			Points:   sdPoints,
 		})
 	}
@@ -192,6 +219,18 @@ func metricLabelsToTsLabels(defaults map[string]labelValue, labelKeys []metricda
 	return labels, nil
 }
 
+// metricValueLabels returns the labels of a time series that have a value.
+// The lengths of labelKeys and labelValues must match.
+func metricValueLabels(labelKeys []metricdata.LabelKey, labelValues []metricdata.LabelValue) map[string]string {
+	labels := make(map[string]string, len(labelKeys))
+	for i, labelKey := range labelKeys {
+		if labelValues[i].Present {
+			labels[labelKey.Key] = labelValues[i].Value
+		}
+	}
+	return labels
+}
+
 // createMetricDescriptorFromMetric creates a metric descriptor from the OpenCensus metric
 // and then creates it remotely using Stackdriver's API.
 func (se *statsExporter) createMetricDescriptorFromMetric(ctx context.Context, metric *metricdata.Metric) error {
@@ -250,7 +289,7 @@ func (se *statsExporter) metricToMpbMetricDescriptor(metric *metricdata.Metric)
 		Type:        metricType,
 		MetricKind:  metricKind,
 		ValueType:   valueType,
-		Labels:      metricLableKeysToLabels(se.defaultLabels, metric.Descriptor.LabelKeys),
+		Labels:      metricLableKeysToLabels(se.labels(), metric.Descriptor.LabelKeys),
 	}
 
 	return sdm, nil
@@ -315,13 +354,7 @@ func metricDescriptorTypeToMetricKind(m *metricdata.Metric) (googlemetricpb.Metr
 
 func (se *statsExporter) metricRscToMpbRsc(rs *resource.Resource) *monitoredrespb.MonitoredResource {
 	if rs == nil {
-		resource := se.o.Resource
-		if resource == nil {
-			resource = &monitoredrespb.MonitoredResource{
-				Type: "global",
-			}
-		}
-		return resource
+		return se.defaultMonitoredResource()
 	}
 	typ := rs.Type
 	if typ == "" {
@@ -337,7 +370,7 @@ func (se *statsExporter) metricRscToMpbRsc(rs *resource.Resource) *monitoredresp
 			mrsp.Labels[k] = v
 		}
 	}
-	return mrsp
+	return se.resources.validate(mrsp)
 }
 
 func (se *statsExporter) metricTsToMpbPoint(ts *metricdata.TimeSeries, metricKind googlemetricpb.MetricDescriptor_MetricKind) (sptl []*monitoringpb.Point, err error) {
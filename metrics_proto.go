@@ -28,6 +28,7 @@ import (
 	"strings"
 
 	"github.com/golang/protobuf/ptypes/timestamp"
+	"go.opencensus.io/metric/metricdata"
 	"go.opencensus.io/stats"
 	"go.opencensus.io/trace"
 
@@ -60,6 +61,7 @@ type metricProtoPayload struct {
 }
 
 func (se *statsExporter) addPayload(node *commonpb.Node, rsc *resourcepb.Resource, labels map[string]labelValue, metrics ...*metricspb.Metric) {
+	_, protoMetricsBundler, _ := se.bundlers()
 	for _, metric := range metrics {
 		payload := &metricProtoPayload{
 			metric:           metric,
@@ -67,7 +69,7 @@ func (se *statsExporter) addPayload(node *commonpb.Node, rsc *resourcepb.Resourc
 			node:             node,
 			additionalLabels: labels,
 		}
-		se.protoMetricsBundler.Add(payload, 1)
+		protoMetricsBundler.Add(payload, 1)
 	}
 }
 
@@ -77,7 +79,7 @@ func (se *statsExporter) ExportMetricsProto(ctx context.Context, node *commonpb.
 		return errNilMetric
 	}
 
-	additionalLabels := se.defaultLabels
+	additionalLabels := se.labels()
 	if additionalLabels == nil {
 		// additionalLabels must be stateless because each node is different
 		additionalLabels = getDefaultLabelsFromNode(node)
@@ -104,7 +106,7 @@ func (se *statsExporter) ExportMetricsProtoSync(ctx context.Context, node *commo
 	// Caches the resources seen so far
 	seenResources := make(map[*resourcepb.Resource]*monitoredrespb.MonitoredResource)
 
-	additionalLabels := se.defaultLabels
+	additionalLabels := se.labels()
 	if additionalLabels == nil {
 		// additionalLabels must be stateless because each node is different
 		additionalLabels = getDefaultLabelsFromNode(node)
@@ -121,14 +123,14 @@ func (se *statsExporter) ExportMetricsProtoSync(ctx context.Context, node *commo
 		if metric.GetMetricDescriptor().GetType() == metricspb.MetricDescriptor_SUMMARY {
 			summaryMtcs := se.convertSummaryMetrics(metric)
 			for _, summaryMtc := range summaryMtcs {
-				if tss, err := se.protoMetricToTimeSeries(ctx, node, mappedRsc, summaryMtc, additionalLabels); err == nil {
+				if tss, err := se.protoMetricToTimeSeries(ctx, node, rsc, mappedRsc, summaryMtc, additionalLabels); err == nil {
 					allTss = append(tss, tss...)
 				} else {
 					allErrs = append(allErrs, err)
 				}
 			}
 		} else {
-			if tss, err := se.protoMetricToTimeSeries(ctx, node, mappedRsc, metric, additionalLabels); err == nil {
+			if tss, err := se.protoMetricToTimeSeries(ctx, node, rsc, mappedRsc, metric, additionalLabels); err == nil {
 				allTss = append(allTss, tss...)
 			} else {
 				allErrs = append(allErrs, err)
@@ -136,20 +138,14 @@ func (se *statsExporter) ExportMetricsProtoSync(ctx context.Context, node *commo
 		}
 
 		if len(allTss) >= maxTimeSeriesPerUpload { // Max 200 time series per request
-			allReqs = append(allReqs, &monitoringpb.CreateTimeSeriesRequest{
-				Name:       monitoring.MetricProjectPath(se.o.ProjectID),
-				TimeSeries: allTss[0:maxTimeSeriesPerUpload],
-			})
+			allReqs = append(allReqs, se.timeSeriesRequestsByProject(allTss[0:maxTimeSeriesPerUpload])...)
 			allTss = allTss[maxTimeSeriesPerUpload:]
 		}
 	}
 
 	// Last batch, if any.
 	if len(allTss) > 0 {
-		allReqs = append(allReqs, &monitoringpb.CreateTimeSeriesRequest{
-			Name:       monitoring.MetricProjectPath(se.o.ProjectID),
-			TimeSeries: allTss,
-		})
+		allReqs = append(allReqs, se.timeSeriesRequestsByProject(allTss)...)
 	}
 
 	// Send create time series requests to Stackdriver.
@@ -306,10 +302,24 @@ func (se *statsExporter) uploadMetricsProto(payloads []*metricProtoPayload) erro
 		}
 	}
 
+	// Descriptors for the projects that time series are routed to.
+	var mds map[string]*googlemetricpb.MetricDescriptor
+	if se.o.GetTimeSeriesProjectID != nil {
+		mds = make(map[string]*googlemetricpb.MetricDescriptor)
+		for _, payload := range payloads {
+			md, err := se.protoToMonitoringMetricDescriptor(payload.metric, payload.additionalLabels)
+			if err != nil {
+				span.SetStatus(trace.Status{Code: 2, Message: err.Error()})
+				return err
+			}
+			mds[md.Type] = md
+		}
+	}
+
 	var allTimeSeries []*monitoringpb.TimeSeries
 	for _, payload := range payloads {
 		mappedRsc := se.getResource(payload.resource, payload.metric, seenResources)
-		tsl, err := se.protoMetricToTimeSeries(ctx, payload.node, mappedRsc, payload.metric, payload.additionalLabels)
+		tsl, err := se.protoMetricToTimeSeries(ctx, payload.node, payload.resource, mappedRsc, payload.metric, payload.additionalLabels)
 		if err != nil {
 			span.SetStatus(trace.Status{Code: 2, Message: err.Error()})
 			return err
@@ -325,6 +335,12 @@ func (se *statsExporter) uploadMetricsProto(payloads []*metricProtoPayload) erro
 		}
 		batch := allTimeSeries[start:end]
 		ctsreql := se.combineTimeSeriesToCreateTimeSeriesRequest(batch)
+		if mds != nil {
+			if err := se.createRoutedMetricDescriptors(ctx, ctsreql, mds); err != nil {
+				span.SetStatus(trace.Status{Code: 2, Message: err.Error()})
+				return err
+			}
+		}
 		for _, ctsreq := range ctsreql {
 			if err := createTimeSeries(ctx, se.c, ctsreq); err != nil {
 				span.SetStatus(trace.Status{Code: trace.StatusCodeUnknown, Message: err.Error()})
@@ -351,10 +367,26 @@ func metricSignature(metric *googlemetricpb.Metric) string {
 	return fmt.Sprintf("%s:%s", metric.GetType(), strings.Join(labelValues, ","))
 }
 
+// combineTimeSeriesToCreateTimeSeriesRequest splits ts into requests per
+// destination project, each holding at most one point per time series.
 func (se *statsExporter) combineTimeSeriesToCreateTimeSeriesRequest(ts []*monitoringpb.TimeSeries) (ctsreql []*monitoringpb.CreateTimeSeriesRequest) {
 	if len(ts) == 0 {
 		return nil
 	}
+	if se.o.GetTimeSeriesProjectID == nil {
+		return combineProjectTimeSeries(se.o.ProjectID, ts)
+	}
+	projects, groups := se.groupTimeSeriesByProject(ts)
+	for _, projectID := range projects {
+		ctsreql = append(ctsreql, combineProjectTimeSeries(projectID, groups[projectID])...)
+	}
+	return ctsreql
+}
+
+func combineProjectTimeSeries(projectID string, ts []*monitoringpb.TimeSeries) (ctsreql []*monitoringpb.CreateTimeSeriesRequest) {
+	if len(ts) == 0 {
+		return nil
+	}
 
 	// Since there are scenarios in which Metrics with the same Type
 	// can be bunched in the same TimeSeries, we have to ensure that
@@ -386,7 +418,7 @@ func (se *statsExporter) combineTimeSeriesToCreateTimeSeriesRequest(ts []*monito
 	// While for each nonUniqueTimeSeries, we have
 	// to make a unique CreateTimeSeriesRequest.
 	ctsreql = append(ctsreql, &monitoringpb.CreateTimeSeriesRequest{
-		Name:       monitoring.MetricProjectPath(se.o.ProjectID),
+		Name:       monitoring.MetricProjectPath(projectID),
 		TimeSeries: uniqueTimeSeries,
 	})
 
@@ -406,7 +438,7 @@ func (se *statsExporter) combineTimeSeriesToCreateTimeSeriesRequest(ts []*monito
 	//      CreateTimeSeries(uniqueTimeSeries)    :: ["a/b/c", "x/y/z", "p/y/z", "d/y/z"]
 	//      CreateTimeSeries(nonUniqueTimeSeries) :: ["a/b/c"]
 	//      CreateTimeSeries(nonUniqueTimeSeries) :: ["a/b/c", "x/y/z"]
-	nonUniqueRequests := se.combineTimeSeriesToCreateTimeSeriesRequest(nonUniqueTimeSeries)
+	nonUniqueRequests := combineProjectTimeSeries(projectID, nonUniqueTimeSeries)
 	ctsreql = append(ctsreql, nonUniqueRequests...)
 
 	return ctsreql
@@ -419,7 +451,7 @@ func (se *statsExporter) getResource(rsc *resourcepb.Resource, metric *metricspb
 	}
 	mappedRsc, ok := seenRscs[resource]
 	if !ok {
-		mappedRsc = se.o.MapResource(resourcepbToResource(resource))
+		mappedRsc = se.resources.validate(se.o.MapResource(resourcepbToResource(resource)))
 		seenRscs[resource] = mappedRsc
 	}
 	return mappedRsc
@@ -441,8 +473,9 @@ func resourcepbToResource(rsc *resourcepb.Resource) *resource.Resource {
 }
 
 // protoMetricToTimeSeries converts a metric into a Stackdriver Monitoring v3 API CreateTimeSeriesRequest
-// but it doesn't invoke any remote API.
-func (se *statsExporter) protoMetricToTimeSeries(ctx context.Context, node *commonpb.Node, mappedRsc *monitoredrespb.MonitoredResource, metric *metricspb.Metric, additionalLabels map[string]labelValue) ([]*monitoringpb.TimeSeries, error) {
+// but it doesn't invoke any remote API. rsc is the resource of the batch the metric was exported in
+// and mappedRsc the monitored resource that its time series are written to.
+func (se *statsExporter) protoMetricToTimeSeries(ctx context.Context, node *commonpb.Node, rsc *resourcepb.Resource, mappedRsc *monitoredrespb.MonitoredResource, metric *metricspb.Metric, additionalLabels map[string]labelValue) ([]*monitoringpb.TimeSeries, error) {
 	if metric == nil {
 		return nil, errNilMetric
 	}
@@ -455,6 +488,18 @@ func (se *statsExporter) protoMetricToTimeSeries(ctx context.Context, node *comm
 	metricLabelKeys := metric.GetMetricDescriptor().GetLabelKeys()
 	metricKind, _ := protoMetricDescriptorTypeToMetricKind(metric)
 
+	var md *metricdata.Descriptor
+	var res *resource.Resource
+	if se.o.GetMetricResource != nil {
+		md = protoDescriptor(metric)
+		if metric.Resource != nil {
+			rsc = metric.Resource
+		}
+		if rsc != nil {
+			res = resourcepbToResource(rsc)
+		}
+	}
+
 	timeSeries := make([]*monitoringpb.TimeSeries, 0, len(metric.Timeseries))
 	for _, protoTimeSeries := range metric.Timeseries {
 		sdPoints, err := se.protoTimeSeriesToMonitoringPoints(protoTimeSeries, metricKind)
@@ -469,12 +514,20 @@ func (se *statsExporter) protoMetricToTimeSeries(ctx context.Context, node *comm
 			// TODO: (@odeke-em) perhaps log this error from labels extraction, if non-nil.
 			continue
 		}
+		tsRsc := mappedRsc
+		if md != nil {
+			var mr *monitoredrespb.MonitoredResource
+			labels, mr = se.selectMetricResource(md, protoValueLabels(metricLabelKeys, protoTimeSeries.GetLabelValues()), res, additionalLabels)
+			if mr != nil {
+				tsRsc = mr
+			}
+		}
 		timeSeries = append(timeSeries, &monitoringpb.TimeSeries{
 			Metric: &googlemetricpb.Metric{
 				Type:   metricType,
 				Labels: labels,
 			},
-			Resource: mappedRsc,
+			Resource: tsRsc,
 			Points:   sdPoints,
 		})
 	}
@@ -502,6 +555,18 @@ func labelsPerTimeSeries(defaults map[string]labelValue, labelKeys []*metricspb.
 	return labels, nil
 }
 
+// protoValueLabels returns the labels of a time series that have a value.
+// The lengths of labelKeys and labelValues must match.
+func protoValueLabels(labelKeys []*metricspb.LabelKey, labelValues []*metricspb.LabelValue) map[string]string {
+	labels := make(map[string]string, len(labelKeys))
+	for i, labelKey := range labelKeys {
+		if labelValues[i].GetHasValue() {
+			labels[labelKey.GetKey()] = labelValues[i].GetValue()
+		}
+	}
+	return labels
+}
+
 func (se *statsExporter) protoMetricDescriptorToCreateMetricDescriptorRequest(ctx context.Context, metric *metricspb.Metric, additionalLabels map[string]labelValue) (*monitoringpb.CreateMetricDescriptorRequest, error) {
 	// Otherwise, we encountered a cache-miss and
 	// should create the metric descriptor remotely.
@@ -0,0 +1,113 @@
+// Copyright 2019, OpenCensus Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package monitoredresource
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+)
+
+// ecsTaskMetadata is used to store parsed ECS task metadata.
+type ecsTaskMetadata struct {
+	// cluster is the name of the ECS cluster the task is running in.
+	cluster string
+
+	// taskID is the identifier of the task, the last part of its ARN.
+	taskID string
+
+	// family is the family of the task definition.
+	family string
+
+	// region is the AWS region of the task.
+	region string
+
+	// availabilityZone is the AWS availability zone of the task. It is only
+	// reported on Fargate and recent ECS agents.
+	availabilityZone string
+
+	// containerName is the name of the container as given in the task definition.
+	containerName string
+}
+
+// ecsMetadataClient is used to query the ECS task metadata endpoint.
+var ecsMetadataClient = &http.Client{Timeout: 2 * time.Second}
+
+// retrieveECSTaskMetadata attempts to retrieve the metadata of the ECS task
+// from the task metadata endpoint v4, whose URL ECS sets in the
+// ECS_CONTAINER_METADATA_URI_V4 environment variable. For details refer to:
+// https://docs.aws.amazon.com/AmazonECS/latest/developerguide/task-metadata-endpoint-v4.html
+// It returns nil outside of ECS.
+func retrieveECSTaskMetadata(ctx context.Context) *ecsTaskMetadata {
+	uri := os.Getenv("ECS_CONTAINER_METADATA_URI_V4")
+	if uri == "" {
+		return nil
+	}
+
+	var task struct {
+		Cluster          string
+		TaskARN          string
+		Family           string
+		AvailabilityZone string
+	}
+	if err := getECSMetadata(ctx, uri+"/task", &task); err != nil {
+		log.Printf("Error retrieving ECS task metadata: %v", err)
+		return nil
+	}
+	var container struct {
+		Name string
+	}
+	if err := getECSMetadata(ctx, uri, &container); err != nil {
+		log.Printf("Error retrieving ECS container metadata: %v", err)
+	}
+
+	// The task ARN has the form
+	// arn:aws:ecs:<region>:<account>:task/<cluster>/<task id>, and the
+	// cluster is given by its ARN or, on older agents, its name.
+	var region string
+	if parts := strings.Split(task.TaskARN, ":"); len(parts) > 3 {
+		region = parts[3]
+	}
+	return &ecsTaskMetadata{
+		cluster:          task.Cluster[strings.LastIndex(task.Cluster, "/")+1:],
+		taskID:           task.TaskARN[strings.LastIndex(task.TaskARN, "/")+1:],
+		family:           task.Family,
+		region:           region,
+		availabilityZone: task.AvailabilityZone,
+		containerName:    container.Name,
+	}
+}
+
+// getECSMetadata decodes the JSON document at url into v.
+func getECSMetadata(ctx context.Context, url string, v interface{}) error {
+	req, err := http.NewRequest("GET", url, nil)
+	if err != nil {
+		return err
+	}
+	resp, err := ecsMetadataClient.Do(req.WithContext(ctx))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("%s returned %s", url, resp.Status)
+	}
+	return json.NewDecoder(resp.Body).Decode(v)
+}
@@ -15,10 +15,18 @@
 package monitoredresource
 
 import (
+	"context"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
 	"github.com/aws/aws-sdk-go/aws/ec2metadata"
 	"github.com/aws/aws-sdk-go/aws/session"
 )
 
+// ec2MetadataEndpoint overrides the endpoint of the EC2 instance metadata
+// service if set. It is used by tests.
+var ec2MetadataEndpoint string
+
 // awsIdentityDocument is used to store parsed AWS Identity Document.
 type awsIdentityDocument struct {
 	// accountID is the AWS account number for the VM.
@@ -34,10 +42,16 @@ type awsIdentityDocument struct {
 // retrieveAWSIdentityDocument attempts to retrieve AWS Identity Document.
 // If the environment is AWS EC2 Instance then a valid document is retrieved.
 // Relevant attributes from the document are stored in awsIdentityDoc.
-// This is only done once.
-func retrieveAWSIdentityDocument() *awsIdentityDocument {
+// Requests to the metadata service are canceled when ctx is done.
+func retrieveAWSIdentityDocument(ctx context.Context) *awsIdentityDocument {
 	awsIdentityDoc := awsIdentityDocument{}
-	c := ec2metadata.New(session.New())
+	// The EC2 metadata client has no context support, so ctx is attached by
+	// its HTTP client. The timeout is the default of the client.
+	cfg := aws.NewConfig().WithHTTPClient(metadataHTTPClient(ctx, 5*time.Second))
+	if ec2MetadataEndpoint != "" {
+		cfg = cfg.WithEndpoint(ec2MetadataEndpoint)
+	}
+	c := ec2metadata.New(session.New(), cfg)
 	if c.Available() == false {
 		return nil
 	}
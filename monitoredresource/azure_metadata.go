@@ -0,0 +1,76 @@
+// Copyright 2019, OpenCensus Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package monitoredresource
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"net/http"
+	"time"
+)
+
+// azureMetadata is used to store parsed Azure Instance Metadata Service data.
+type azureMetadata struct {
+	// location is the Azure region of the VM, such as "westus".
+	location string
+
+	// resourceGroupName is the resource group of the VM.
+	resourceGroupName string
+
+	// vmName is the name of the VM, unique within its resource group.
+	vmName string
+}
+
+// azureMetadataURL is the compute endpoint of the Azure Instance Metadata
+// Service. For details refer to:
+// https://docs.microsoft.com/en-us/azure/virtual-machines/windows/instance-metadata-service
+var azureMetadataURL = "http://169.254.169.254/metadata/instance/compute?api-version=2019-06-01"
+
+// azureMetadataClient is used to query the Azure Instance Metadata Service.
+var azureMetadataClient = &http.Client{Timeout: 2 * time.Second}
+
+// retrieveAzureMetadata attempts to retrieve the metadata of the Azure VM
+// from the compute endpoint at url. It returns nil outside of Azure.
+func retrieveAzureMetadata(ctx context.Context, url string) *azureMetadata {
+	req, err := http.NewRequest("GET", url, nil)
+	if err != nil {
+		return nil
+	}
+	req.Header.Set("Metadata", "true")
+	resp, err := azureMetadataClient.Do(req.WithContext(ctx))
+	if err != nil {
+		// Not an Azure environment
+		return nil
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil
+	}
+	var compute struct {
+		Location          string
+		Name              string
+		ResourceGroupName string
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&compute); err != nil {
+		log.Printf("Error decoding Azure instance metadata: %v", err)
+		return nil
+	}
+	return &azureMetadata{
+		location:          compute.Location,
+		resourceGroupName: compute.ResourceGroupName,
+		vmName:            compute.Name,
+	}
+}
@@ -0,0 +1,377 @@
+// Copyright 2019, OpenCensus Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package monitoredresource
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+)
+
+// Provider identifies an environment probed during resource detection.
+type Provider string
+
+// Providers probed during resource detection.
+const (
+	// GCP detects Cloud Functions, App Engine, Cloud Run, GKE and GCE from
+	// the GCP metadata server.
+	GCP Provider = "gcp"
+
+	// ECS detects Amazon ECS tasks from the ECS task metadata endpoint.
+	ECS Provider = "ecs"
+
+	// AWS detects Amazon EKS containers and EC2 instances from the EC2
+	// instance metadata service.
+	AWS Provider = "aws"
+
+	// Azure detects Azure VMs from the Azure Instance Metadata Service.
+	Azure Provider = "azure"
+)
+
+// DefaultDetectionOrder is the order in which the results of the providers
+// are considered by default.
+var DefaultDetectionOrder = []Provider{GCP, ECS, AWS, Azure}
+
+// DetectOptions configures resource detection.
+type DetectOptions struct {
+	// Order lists the providers to probe. All providers are probed in
+	// parallel, and the resource is taken from the first provider in Order
+	// that detects its environment. Providers not listed are not probed.
+	// Optional. Defaults to DefaultDetectionOrder.
+	Order []Provider
+
+	// Disabled lists providers that are not probed even if they are listed
+	// in Order.
+	// Optional.
+	Disabled map[Provider]bool
+
+	// Timeouts bounds the time spent probing each provider. A provider that
+	// has not answered in time is considered absent, and its requests are
+	// canceled. Providers without a timeout are bounded by ctx and the
+	// timeouts of their requests: 2 seconds per request, or 5 seconds for
+	// the EC2 instance metadata service.
+	// Optional.
+	Timeouts map[Provider]time.Duration
+
+	// UseGKEClusterAPI makes detection on GKE ask the GKE API whether the
+	// cluster uses Kubernetes Engine Monitoring, and report gke_container if
+	// it does not. This needs network access to the GKE API and the
+	// container.clusters.get permission. By default k8s_container is
+	// reported without calling the API.
+	// Optional.
+	UseGKEClusterAPI bool
+
+	// NonBlocking makes AutodetectContext return at once, without waiting
+	// for detection to finish. The returned resource is global until
+	// detection finishes in the background, and the detected resource
+	// afterwards. The exporter converts Options.MonitoredResource once when
+	// it is created, so return the resource from Options.GetMonitoredResource
+	// to have metrics pick up the detected resource.
+	// Optional.
+	NonBlocking bool
+}
+
+// probeResults holds the metadata retrieved by each probe. A field is nil if
+// the probe was not run or did not find its environment.
+type probeResults struct {
+	gcp   *gcpMetadata
+	ecs   *ecsTaskMetadata
+	aws   *awsIdentityDocument
+	azure *azureMetadata
+}
+
+var (
+	// detectMu guards autoDetected.
+	detectMu sync.Mutex
+
+	// autoDetected is the resource returned by Autodetect and
+	// AutodetectContext once detection has finished.
+	autoDetected Interface
+)
+
+// AutodetectContext detects the monitored resource of the environment where
+// the application is running, like Autodetect, as configured by opts.
+//
+// The result of the first detection that finishes is cached and returned by
+// later calls of Autodetect and AutodetectContext, whatever their options.
+// If ctx is done before all providers have answered, the resource detected
+// by the providers that have answered is returned but not cached, and the
+// next call probes the environment again.
+//
+// With opts.NonBlocking, AutodetectContext returns at once; ctx then bounds
+// the detection running in the background.
+func AutodetectContext(ctx context.Context, opts DetectOptions) Interface {
+	detectMu.Lock()
+	mr := autoDetected
+	detectMu.Unlock()
+	if mr != nil {
+		return mr
+	}
+
+	if !opts.NonBlocking {
+		return autodetect(ctx, opts)
+	}
+	pending := &pendingResource{}
+	go func() {
+		pending.set(autodetect(ctx, opts))
+	}()
+	return pending
+}
+
+// autodetect detects the monitored resource and caches it if detection
+// finished.
+func autodetect(ctx context.Context, opts DetectOptions) Interface {
+	mr, complete := detect(ctx, opts)
+	if !complete {
+		return mr
+	}
+	detectMu.Lock()
+	defer detectMu.Unlock()
+	if autoDetected == nil {
+		autoDetected = mr
+	}
+	return autoDetected
+}
+
+// SetAutodetected makes Autodetect and AutodetectContext return mr without
+// probing the environment. It is meant for tests.
+func SetAutodetected(mr Interface) {
+	detectMu.Lock()
+	defer detectMu.Unlock()
+	autoDetected = mr
+}
+
+// ResetAutodetect forgets the cached result of Autodetect and
+// AutodetectContext, so that the next call probes the environment again.
+func ResetAutodetect() {
+	SetAutodetected(nil)
+}
+
+// pendingResource is the global resource until the resource detected in
+// the background is set.
+type pendingResource struct {
+	mu sync.RWMutex
+	mr Interface
+}
+
+func (p *pendingResource) set(mr Interface) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.mr = mr
+}
+
+// MonitoredResource returns the detected resource type and labels, or the
+// global type until detection finishes.
+func (p *pendingResource) MonitoredResource() (resType string, labels map[string]string) {
+	p.mu.RLock()
+	mr := p.mr
+	p.mu.RUnlock()
+	if mr == nil {
+		return "global", nil
+	}
+	return mr.MonitoredResource()
+}
+
+// Detect probes the environment where the application is running as
+// configured by opts, and returns its monitored resource. If no provider
+// detects its environment, Detect returns a generic_node resource for the
+// host. Unlike Autodetect, Detect probes the environment on every call.
+// Probing stops when ctx is done; opts.NonBlocking is ignored.
+func Detect(ctx context.Context, opts DetectOptions) Interface {
+	mr, _ := detect(ctx, opts)
+	return mr
+}
+
+// detect probes the environment and reports whether all probes finished
+// before ctx was done.
+func detect(ctx context.Context, opts DetectOptions) (mr Interface, complete bool) {
+	order := opts.Order
+	if order == nil {
+		order = DefaultDetectionOrder
+	}
+
+	var (
+		results probeResults
+		mu      sync.Mutex
+		wg      sync.WaitGroup
+	)
+	complete = true
+	// Each probe retrieves its metadata with its own context, which is
+	// canceled when the probe times out or returns, so that no requests
+	// outlive detection.
+	probe := func(p Provider, retrieve func(context.Context), set func()) {
+		defer wg.Done()
+		pctx, cancel := context.WithCancel(ctx)
+		if d := opts.Timeouts[p]; d > 0 {
+			pctx, cancel = context.WithTimeout(ctx, d)
+		}
+		defer cancel()
+		done := make(chan struct{})
+		go func() {
+			retrieve(pctx)
+			close(done)
+		}()
+		select {
+		case <-done:
+		case <-pctx.Done():
+		}
+		mu.Lock()
+		defer mu.Unlock()
+		switch {
+		case pctx.Err() == nil:
+			set()
+		case ctx.Err() != nil:
+			complete = false
+		}
+	}
+	for _, p := range order {
+		if opts.Disabled[p] {
+			continue
+		}
+		wg.Add(1)
+		switch p {
+		case GCP:
+			var md *gcpMetadata
+			go probe(p, func(ctx context.Context) { md = retrieveGCPMetadata(ctx, opts.UseGKEClusterAPI) }, func() { results.gcp = md })
+		case ECS:
+			var md *ecsTaskMetadata
+			go probe(p, func(ctx context.Context) { md = retrieveECSTaskMetadata(ctx) }, func() { results.ecs = md })
+		case AWS:
+			var md *awsIdentityDocument
+			go probe(p, func(ctx context.Context) { md = retrieveAWSIdentityDocument(ctx) }, func() { results.aws = md })
+		case Azure:
+			var md *azureMetadata
+			url := azureMetadataURL
+			go probe(p, func(ctx context.Context) { md = retrieveAzureMetadata(ctx, url) }, func() { results.azure = md })
+		default:
+			wg.Done()
+		}
+	}
+	wg.Wait()
+
+	return detectResourceType(order, &results), complete
+}
+
+// detectResourceType determines the resource type from the results of the
+// providers in order, falling back to a generic_node for the host.
+func detectResourceType(order []Provider, results *probeResults) Interface {
+	for _, p := range order {
+		if mr := results.resource(p); mr != nil {
+			return mr
+		}
+	}
+	return createGenericNodeMonitoredResource()
+}
+
+// resource returns the monitored resource detected by the provider p, or nil.
+func (r *probeResults) resource(p Provider) Interface {
+	switch p {
+	case GCP:
+		gcpMetadata := r.gcp
+		if gcpMetadata == nil {
+			return nil
+		}
+		// The metadata server also answers in serverless environments, so
+		// they are checked before GKE and GCE.
+		if gcpMetadata.functionName != "" {
+			return createCloudFunctionMonitoredResource(gcpMetadata)
+		} else if gcpMetadata.moduleID != "" {
+			return createGAEInstanceMonitoredResource(gcpMetadata)
+		} else if gcpMetadata.serviceName != "" {
+			return createCloudRunRevisionMonitoredResource(gcpMetadata)
+		} else if os.Getenv("KUBERNETES_SERVICE_HOST") != "" && gcpMetadata.instanceID != "" {
+			return createGKEContainerMonitoredResource(gcpMetadata)
+		} else if gcpMetadata.instanceID != "" {
+			return createGCEInstanceMonitoredResource(gcpMetadata)
+		}
+	case ECS:
+		if r.ecs != nil {
+			return createECSTaskMonitoredResource(r.ecs)
+		}
+	case AWS:
+		// On EKS Fargate there is no instance metadata, but AWS_REGION is set.
+		if os.Getenv("KUBERNETES_SERVICE_HOST") != "" && (r.aws != nil || os.Getenv("AWS_REGION") != "") {
+			return createEKSMonitoredResource(r.aws)
+		} else if r.aws != nil {
+			return createAWSEC2InstanceMonitoredResource(r.aws)
+		}
+	case Azure:
+		if r.azure != nil {
+			return createAzureVMMonitoredResource(r.azure)
+		}
+	}
+	return nil
+}
+
+// createAzureVMMonitoredResource creates a generic_node monitored resource
+// azureMetadata contains Azure VM specific attributes.
+func createAzureVMMonitoredResource(azureMetadata *azureMetadata) *GenericNode {
+	genericNode := GenericNode{
+		Location:  fmt.Sprintf("azure:%s", azureMetadata.location),
+		Namespace: namespaceOrDefault(azureMetadata.resourceGroupName),
+		NodeID:    azureMetadata.vmName,
+	}
+	return &genericNode
+}
+
+// createGenericNodeMonitoredResource creates a generic_node monitored resource
+// for a host outside of the supported clouds, identified by its hostname.
+func createGenericNodeMonitoredResource() *GenericNode {
+	hostname, err := os.Hostname()
+	if err != nil {
+		hostname = "unknown"
+	}
+	genericNode := GenericNode{
+		Location:  "global",
+		Namespace: defaultNamespace,
+		NodeID:    hostname,
+	}
+	return &genericNode
+}
+
+// defaultNamespace is the namespace of generic_node resources for which none
+// is known. Stackdriver Monitoring requires a non-empty namespace.
+const defaultNamespace = "default"
+
+func namespaceOrDefault(namespace string) string {
+	if namespace == "" {
+		return defaultNamespace
+	}
+	return namespace
+}
+
+// contextTransport sends requests with ctx, so that canceling ctx stops
+// the requests of clients that don't take a context, such as the GCP
+// metadata client and the EC2 metadata client.
+type contextTransport struct {
+	ctx  context.Context
+	base http.RoundTripper
+}
+
+func (t contextTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	return t.base.RoundTrip(req.WithContext(t.ctx))
+}
+
+// metadataHTTPClient returns an HTTP client whose requests are canceled
+// with ctx and time out after timeout.
+func metadataHTTPClient(ctx context.Context, timeout time.Duration) *http.Client {
+	return &http.Client{
+		Transport: contextTransport{ctx: ctx, base: http.DefaultTransport},
+		Timeout:   timeout,
+	}
+}
@@ -0,0 +1,211 @@
+// Copyright 2019, OpenCensus Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package monitoredresource
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+	"time"
+)
+
+// fakeAzureMetadataServer serves the compute metadata of an Azure VM, after
+// delay, until the returned function is called.
+func fakeAzureMetadataServer(t *testing.T, delay time.Duration) func() {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Metadata") != "true" {
+			t.Errorf("request to %s without Metadata header", r.URL.Path)
+		}
+		time.Sleep(delay)
+		w.Write([]byte(`{"location": "westus", "name": "vm1", "resourceGroupName": "rg1", "vmId": "02aab8a4-74ef-476e-8182-f6d2ba4166a6"}`))
+	}))
+	old := azureMetadataURL
+	azureMetadataURL = srv.URL + "/metadata/instance/compute?api-version=2019-06-01"
+	return func() {
+		azureMetadataURL = old
+		srv.Close()
+	}
+}
+
+func TestAzureVMMonitoredResources(t *testing.T) {
+	defer fakeAzureMetadataServer(t, 0)()
+
+	autoDetected := Detect(context.Background(), DetectOptions{Order: []Provider{Azure}})
+
+	resType, labels := autoDetected.MonitoredResource()
+	if resType != "generic_node" ||
+		labels["location"] != "azure:westus" ||
+		labels["namespace"] != "rg1" ||
+		labels["node_id"] != "vm1" {
+		t.Errorf("AzureVMMonitoredResource Failed: %v", autoDetected)
+	}
+}
+
+func TestGenericNodeMonitoredResources(t *testing.T) {
+	hostname, err := os.Hostname()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	autoDetected := detectResourceType(DefaultDetectionOrder, &probeResults{gcp: &gcpMetadata{}})
+
+	resType, labels := autoDetected.MonitoredResource()
+	if resType != "generic_node" ||
+		labels["location"] != "global" ||
+		labels["namespace"] != "default" ||
+		labels["node_id"] != hostname {
+		t.Errorf("GenericNodeMonitoredResource Failed: %v", autoDetected)
+	}
+}
+
+func TestDetectionOrder(t *testing.T) {
+	os.Setenv("KUBERNETES_SERVICE_HOST", "")
+	results := &probeResults{
+		gcp:   &gcpMetadata{instanceID: GCPInstanceIDStr, projectID: GCPProjectIDStr, zone: GCPZoneStr},
+		azure: &azureMetadata{location: "westus", resourceGroupName: "rg1", vmName: "vm1"},
+	}
+
+	if resType, _ := detectResourceType(DefaultDetectionOrder, results).MonitoredResource(); resType != "gce_instance" {
+		t.Errorf("resource type with the default order = %q; want gce_instance", resType)
+	}
+	if resType, _ := detectResourceType([]Provider{Azure, GCP}, results).MonitoredResource(); resType != "generic_node" {
+		t.Errorf("resource type with Azure first = %q; want generic_node", resType)
+	}
+}
+
+func TestDetectTimeout(t *testing.T) {
+	defer fakeAzureMetadataServer(t, 300*time.Millisecond)()
+
+	start := time.Now()
+	autoDetected := Detect(context.Background(), DetectOptions{
+		Order:    []Provider{Azure},
+		Timeouts: map[Provider]time.Duration{Azure: 50 * time.Millisecond},
+	})
+	if d := time.Since(start); d > 250*time.Millisecond {
+		t.Errorf("Detect took %v; want the Azure probe to time out after 50ms", d)
+	}
+	if _, labels := autoDetected.MonitoredResource(); labels["location"] != "global" {
+		t.Errorf("Detect() = %v; want the generic_node fallback", autoDetected)
+	}
+}
+
+func TestDetectTimeoutCancelsRequests(t *testing.T) {
+	canceled := make(chan string, 2)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-r.Context().Done():
+			canceled <- r.URL.Path
+		case <-time.After(5 * time.Second):
+		}
+	}))
+	defer srv.Close()
+	oldAzure := azureMetadataURL
+	azureMetadataURL = srv.URL + "/azure"
+	ec2MetadataEndpoint = srv.URL + "/latest"
+	defer func() {
+		azureMetadataURL = oldAzure
+		ec2MetadataEndpoint = ""
+	}()
+
+	Detect(context.Background(), DetectOptions{
+		Order:    []Provider{AWS, Azure},
+		Timeouts: map[Provider]time.Duration{AWS: 50 * time.Millisecond, Azure: 50 * time.Millisecond},
+	})
+	for i := 0; i < 2; i++ {
+		select {
+		case <-canceled:
+		case <-time.After(time.Second):
+			t.Fatal("request of a timed out probe was not canceled")
+		}
+	}
+}
+
+func TestDetectDisabled(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		t.Errorf("disabled provider was probed: %s", r.URL)
+	}))
+	defer srv.Close()
+	old := azureMetadataURL
+	azureMetadataURL = srv.URL
+	defer func() { azureMetadataURL = old }()
+
+	autoDetected := Detect(context.Background(), DetectOptions{
+		Order:    []Provider{Azure},
+		Disabled: map[Provider]bool{Azure: true},
+	})
+	if resType, labels := autoDetected.MonitoredResource(); resType != "generic_node" || labels["location"] != "global" {
+		t.Errorf("Detect() = %v; want the generic_node fallback", autoDetected)
+	}
+}
+
+func TestAutodetectContextDeadline(t *testing.T) {
+	defer fakeAzureMetadataServer(t, 300*time.Millisecond)()
+	defer ResetAutodetect()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	autoDetected := AutodetectContext(ctx, DetectOptions{Order: []Provider{Azure}})
+	if d := time.Since(start); d > 250*time.Millisecond {
+		t.Errorf("AutodetectContext took %v; want it to return at the 50ms deadline", d)
+	}
+	if _, labels := autoDetected.MonitoredResource(); labels["location"] != "global" {
+		t.Errorf("AutodetectContext() = %v; want the generic_node fallback", autoDetected)
+	}
+
+	autoDetected = AutodetectContext(context.Background(), DetectOptions{Order: []Provider{Azure}})
+	if _, labels := autoDetected.MonitoredResource(); labels["location"] != "azure:westus" {
+		t.Errorf("AutodetectContext() after an incomplete detection = %v; want the Azure VM", autoDetected)
+	}
+}
+
+func TestAutodetectNonBlocking(t *testing.T) {
+	defer fakeAzureMetadataServer(t, 100*time.Millisecond)()
+	defer ResetAutodetect()
+
+	autoDetected := AutodetectContext(context.Background(), DetectOptions{Order: []Provider{Azure}, NonBlocking: true})
+	if resType, _ := autoDetected.MonitoredResource(); resType != "global" {
+		t.Errorf("resource type before detection finished = %q; want global", resType)
+	}
+
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		if resType, _ := autoDetected.MonitoredResource(); resType == "generic_node" {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("resource was not upgraded after detection")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if resType, labels := Autodetect().MonitoredResource(); resType != "generic_node" || labels["location"] != "azure:westus" {
+		t.Errorf("Autodetect() after background detection = %v, %v; want the cached Azure VM", resType, labels)
+	}
+}
+
+func TestSetAutodetected(t *testing.T) {
+	defer ResetAutodetect()
+	gce := &GCEInstance{ProjectID: GCPProjectIDStr, InstanceID: GCPInstanceIDStr, Zone: GCPZoneStr}
+
+	SetAutodetected(gce)
+	if got := Autodetect(); got != gce {
+		t.Errorf("Autodetect() = %v; want the injected %v", got, gce)
+	}
+	if got := AutodetectContext(context.Background(), DetectOptions{NonBlocking: true}); got != gce {
+		t.Errorf("AutodetectContext() = %v; want the injected %v", got, gce)
+	}
+}
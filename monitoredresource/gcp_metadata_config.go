@@ -18,15 +18,18 @@ import (
 	"context"
 	"fmt"
 	"log"
-	"os"
 	"strings"
+	"time"
 
 	"cloud.google.com/go/compute/metadata"
 	"cloud.google.com/go/container/apiv1"
 	containerpb "google.golang.org/genproto/googleapis/container/v1"
+
+	"contrib.go.opencensus.io/exporter/stackdriver/internal/gcpenv"
 )
 
-// gcpMetadata represents metadata retrieved from GCP (GKE and GCE) environment.
+// gcpMetadata represents metadata retrieved from GCP (Cloud Functions, App Engine,
+// Cloud Run, GKE and GCE) environment.
 type gcpMetadata struct {
 
 	// projectID is the identifier of the GCP project associated with this resource, such as "my-project".
@@ -50,63 +53,133 @@ type gcpMetadata struct {
 	// zone is the Compute Engine zone in which the VM is running.
 	zone string
 
+	// clusterLocation is the zone or region of the cluster the container is running in.
+	clusterLocation string
+
 	monitoringV2 bool
+
+	// region is the region in which a Cloud Run service or Cloud Function is running.
+	region string
+
+	// functionName is the name of the Cloud Function.
+	functionName string
+
+	// moduleID is the name of the App Engine service.
+	moduleID string
+
+	// versionID is the version of the App Engine service.
+	versionID string
+
+	// gaeInstanceID is the identifier of the App Engine instance.
+	gaeInstanceID string
+
+	// serviceName is the name of the Cloud Run service.
+	serviceName string
+
+	// revisionName is the name of the Cloud Run revision.
+	revisionName string
+
+	// configurationName is the name of the Cloud Run configuration.
+	configurationName string
 }
 
 // retrieveGCPMetadata retrieves value of each Attribute from Metadata Server
-// in GKE container and GCE instance environment.
+// in Cloud Functions, App Engine, Cloud Run, GKE container and GCE instance environment.
 // Some attributes are retrieved from the system environment.
-// This is only executed detectOnce.
-func retrieveGCPMetadata() *gcpMetadata {
+// On GKE, k8s_container is reported unless useClusterAPI is set; the GKE API
+// is then asked whether the cluster uses Kubernetes Engine Monitoring. All
+// requests are made within ctx.
+func retrieveGCPMetadata(ctx context.Context, useClusterAPI bool) *gcpMetadata {
 	gcpMetadata := gcpMetadata{}
+	mc := metadata.NewClient(metadataHTTPClient(ctx, 2*time.Second))
 	var err error
-	gcpMetadata.instanceID, err = metadata.InstanceID()
+	gcpMetadata.instanceID, err = mc.InstanceID()
 	if err != nil {
 		// Not a GCP environment
 		return &gcpMetadata
 	}
 
-	gcpMetadata.projectID, err = metadata.ProjectID()
+	gcpMetadata.projectID, err = mc.ProjectID()
 	logError(err)
 
-	gcpMetadata.zone, err = metadata.Zone()
+	gcpMetadata.zone, err = mc.Zone()
 	logError(err)
 
-	clusterName, err := metadata.InstanceAttributeValue("cluster-name")
+	// Serverless platforms are detected from their environment variables.
+	env := gcpenv.DetectServerless()
+	switch {
+	case env.FunctionName != "":
+		gcpMetadata.functionName = env.FunctionName
+		gcpMetadata.region = env.FunctionRegion
+		if gcpMetadata.region == "" {
+			gcpMetadata.region = retrieveRegion(mc)
+		}
+		return &gcpMetadata
+	case env.GAEService != "":
+		gcpMetadata.moduleID = env.GAEService
+		gcpMetadata.versionID = env.GAEVersion
+		gcpMetadata.gaeInstanceID = env.GAEInstance
+		return &gcpMetadata
+	case env.RunService != "":
+		gcpMetadata.serviceName = env.RunService
+		gcpMetadata.revisionName = env.RunRevision
+		gcpMetadata.configurationName = env.RunConfiguration
+		gcpMetadata.region = retrieveRegion(mc)
+		return &gcpMetadata
+	}
+
+	clusterName, err := mc.InstanceAttributeValue("cluster-name")
 	logError(err)
 	gcpMetadata.clusterName = strings.TrimSpace(clusterName)
 
-	clusterLocation, err := metadata.InstanceAttributeValue("cluster-location")
+	clusterLocation, err := mc.InstanceAttributeValue("cluster-location")
 	logError(err)
 
-	// Following attributes are derived from environment variables. They are configured
-	// via yaml file. For details refer to:
-	// https://cloud.google.com/kubernetes-engine/docs/tutorials/custom-metrics-autoscaling#exporting_metrics_from_the_application
-	gcpMetadata.namespaceID = os.Getenv("NAMESPACE")
-	gcpMetadata.containerName = os.Getenv("CONTAINER_NAME")
-	gcpMetadata.podID = os.Getenv("HOSTNAME")
+	// Following attributes are derived from the downward API and environment
+	// variables, see retrieveK8sPodInfo.
+	podInfo := retrieveK8sPodInfo()
+	gcpMetadata.namespaceID = podInfo.namespace
+	gcpMetadata.containerName = podInfo.containerName
+	gcpMetadata.podID = podInfo.podName
+	gcpMetadata.clusterLocation = gcpenv.FirstOf(podInfo.clusterLocation, strings.TrimSpace(clusterLocation))
 
-	// Monitoring API version can be obtained from cluster info.q
 	if gcpMetadata.clusterName != "" {
-		ctx := context.Background()
-		c, err := container.NewClusterManagerClient(ctx)
-		logError(err)
-		if c != nil {
-			req := &containerpb.GetClusterRequest{
-				Name: fmt.Sprintf("projects/%s/locations/%s/clusters/%s", gcpMetadata.projectID, strings.TrimSpace(clusterLocation), gcpMetadata.clusterName),
-			}
-			resp, err := c.GetCluster(ctx, req)
-			logError(err)
-			if resp != nil && resp.GetMonitoringService() == "monitoring.googleapis.com/kubernetes" &&
-				resp.GetLoggingService() == "logging.googleapis.com/kubernetes" {
-				gcpMetadata.monitoringV2 = true
-			}
+		if useClusterAPI {
+			gcpMetadata.monitoringV2 = retrieveGKEMonitoringV2(ctx, &gcpMetadata)
+		} else {
+			gcpMetadata.monitoringV2 = true
 		}
 	}
 
 	return &gcpMetadata
 }
 
+// retrieveGKEMonitoringV2 asks the GKE API whether the cluster uses Kubernetes
+// Engine Monitoring. This requires the container.clusters.get permission.
+func retrieveGKEMonitoringV2(ctx context.Context, gcpMetadata *gcpMetadata) bool {
+	c, err := container.NewClusterManagerClient(ctx)
+	logError(err)
+	if c == nil {
+		return false
+	}
+	defer c.Close()
+	req := &containerpb.GetClusterRequest{
+		Name: fmt.Sprintf("projects/%s/locations/%s/clusters/%s", gcpMetadata.projectID, gcpMetadata.clusterLocation, gcpMetadata.clusterName),
+	}
+	resp, err := c.GetCluster(ctx, req)
+	logError(err)
+	return resp != nil && resp.GetMonitoringService() == "monitoring.googleapis.com/kubernetes" &&
+		resp.GetLoggingService() == "logging.googleapis.com/kubernetes"
+}
+
+// retrieveRegion retrieves the region of a serverless environment from the
+// Metadata Server, which returns it as "projects/<number>/regions/<region>".
+func retrieveRegion(mc *metadata.Client) string {
+	region, err := mc.Get("instance/region")
+	logError(err)
+	return region[strings.LastIndex(region, "/")+1:]
+}
+
 // logError logs error only if the error is present and it is not 'not defined'
 func logError(err error) {
 	if err != nil {
@@ -0,0 +1,83 @@
+// Copyright 2019, OpenCensus Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package monitoredresource
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"contrib.go.opencensus.io/exporter/stackdriver/internal/gcpenv"
+)
+
+// k8sPodInfo describes the Kubernetes container the application is running in.
+type k8sPodInfo struct {
+	// podName is the name of the pod.
+	podName string
+
+	// namespace is the namespace of the pod.
+	namespace string
+
+	// containerName is the name of the container in the pod spec.
+	containerName string
+
+	// clusterLocation is the location of the cluster, if configured.
+	clusterLocation string
+}
+
+var (
+	// podInfoDir is where a downward API volume is mounted, as in the
+	// Kubernetes documentation:
+	// https://kubernetes.io/docs/tasks/inject-data-application/downward-api-volume-expose-pod-information/
+	podInfoDir = "/etc/podinfo"
+
+	// serviceAccountDir is where Kubernetes mounts the service account
+	// credentials of the pod, including its namespace.
+	serviceAccountDir = "/var/run/secrets/kubernetes.io/serviceaccount"
+)
+
+// retrieveK8sPodInfo reads the pod information from the environment and
+// from files, without calling the Kubernetes or GKE APIs. Each attribute is
+// taken from the first of the following that is set:
+//
+//	pod name:         POD_NAME, <podInfoDir>/name, HOSTNAME
+//	namespace:        POD_NAMESPACE, NAMESPACE, <podInfoDir>/namespace,
+//	                  <serviceAccountDir>/namespace
+//	container name:   CONTAINER_NAME, <podInfoDir>/container_name
+//	cluster location: CLUSTER_LOCATION, <podInfoDir>/cluster_location
+//
+// POD_NAME, POD_NAMESPACE and the podinfo files are set through the downward
+// API, from metadata.name and metadata.namespace. The container name and
+// cluster location are not available through the downward API and must be
+// set in the pod spec.
+func retrieveK8sPodInfo() *k8sPodInfo {
+	return &k8sPodInfo{
+		podName:         gcpenv.FirstOf(os.Getenv("POD_NAME"), readPodInfo(podInfoDir, "name"), os.Getenv("HOSTNAME")),
+		namespace:       gcpenv.FirstOf(os.Getenv("POD_NAMESPACE"), os.Getenv("NAMESPACE"), readPodInfo(podInfoDir, "namespace"), readPodInfo(serviceAccountDir, "namespace")),
+		containerName:   gcpenv.FirstOf(os.Getenv("CONTAINER_NAME"), readPodInfo(podInfoDir, "container_name")),
+		clusterLocation: gcpenv.FirstOf(os.Getenv("CLUSTER_LOCATION"), readPodInfo(podInfoDir, "cluster_location")),
+	}
+}
+
+// readPodInfo returns the trimmed content of the file name in dir, or "" if
+// it cannot be read.
+func readPodInfo(dir, name string) string {
+	b, err := ioutil.ReadFile(filepath.Join(dir, name))
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(string(b))
+}
@@ -15,9 +15,9 @@
 package monitoredresource
 
 import (
+	"context"
 	"fmt"
 	"os"
-	"sync"
 )
 
 // Interface is a type that represent monitor resource that satisfies monitoredresource.Interface
@@ -53,6 +53,10 @@ type GKEContainer struct {
 	// Zone is the Compute Engine zone in which the VM is running.
 	Zone string
 
+	// ClusterLocation is the zone or region of the cluster, reported as the
+	// location of k8s_container. Defaults to Zone.
+	ClusterLocation string
+
 	// LoggingMonitoringV2Enabled is the identifier if user enabled V2 logging and monitoring for GKE
 	LoggingMonitoringV2Enabled bool
 }
@@ -69,7 +73,10 @@ func (gke *GKEContainer) MonitoredResource() (resType string, labels map[string]
 		typ = "k8s_container"
 		labels["pod_name"] = gke.PodID
 		labels["namespace_name"] = gke.NamespaceID
-		labels["location"] = gke.Zone
+		labels["location"] = gke.ClusterLocation
+		if gke.ClusterLocation == "" {
+			labels["location"] = gke.Zone
+		}
 	} else {
 		typ = "gke_container"
 		labels["pod_id"] = gke.PodID
@@ -132,44 +139,231 @@ func (aws *AWSEC2Instance) MonitoredResource() (resType string, labels map[strin
 	return "aws_ec2_instance", labels
 }
 
+// CloudRunRevision represents cloud_run_revision type monitored resource.
+// For definition refer to
+// https://cloud.google.com/monitoring/api/resources#tag_cloud_run_revision
+type CloudRunRevision struct {
+
+	// ProjectID is the identifier of the GCP project associated with this resource, such as "my-project".
+	ProjectID string
+
+	// ServiceName is the name of the Cloud Run service.
+	ServiceName string
+
+	// RevisionName is the name of the revision of the service.
+	RevisionName string
+
+	// ConfigurationName is the name of the configuration the revision was created from.
+	ConfigurationName string
+
+	// Location is the region in which the service is running.
+	Location string
+}
+
+// MonitoredResource returns resource type and resource labels for CloudRunRevision
+func (cr *CloudRunRevision) MonitoredResource() (resType string, labels map[string]string) {
+	labels = map[string]string{
+		"project_id":         cr.ProjectID,
+		"service_name":       cr.ServiceName,
+		"revision_name":      cr.RevisionName,
+		"configuration_name": cr.ConfigurationName,
+		"location":           cr.Location,
+	}
+	return "cloud_run_revision", labels
+}
+
+// GAEInstance represents gae_instance type monitored resource.
+// For definition refer to
+// https://cloud.google.com/monitoring/api/resources#tag_gae_instance
+type GAEInstance struct {
+
+	// ProjectID is the identifier of the GCP project associated with this resource, such as "my-project".
+	ProjectID string
+
+	// ModuleID is the name of the App Engine service.
+	ModuleID string
+
+	// VersionID is the version of the App Engine service.
+	VersionID string
+
+	// InstanceID is the identifier of the App Engine instance.
+	InstanceID string
+
+	// Location is the zone in which the instance is running.
+	Location string
+}
+
+// MonitoredResource returns resource type and resource labels for GAEInstance
+func (gae *GAEInstance) MonitoredResource() (resType string, labels map[string]string) {
+	labels = map[string]string{
+		"project_id":  gae.ProjectID,
+		"module_id":   gae.ModuleID,
+		"version_id":  gae.VersionID,
+		"instance_id": gae.InstanceID,
+		"location":    gae.Location,
+	}
+	return "gae_instance", labels
+}
+
+// CloudFunction represents cloud_function type monitored resource.
+// For definition refer to
+// https://cloud.google.com/monitoring/api/resources#tag_cloud_function
+type CloudFunction struct {
+
+	// ProjectID is the identifier of the GCP project associated with this resource, such as "my-project".
+	ProjectID string
+
+	// FunctionName is the name of the function.
+	FunctionName string
+
+	// Region is the region in which the function is running.
+	Region string
+}
+
+// MonitoredResource returns resource type and resource labels for CloudFunction
+func (cf *CloudFunction) MonitoredResource() (resType string, labels map[string]string) {
+	labels = map[string]string{
+		"project_id":    cf.ProjectID,
+		"function_name": cf.FunctionName,
+		"region":        cf.Region,
+	}
+	return "cloud_function", labels
+}
+
+// K8sContainer represents k8s_container type monitored resource outside of
+// GKE, such as on Amazon EKS.
+// For definition refer to
+// https://cloud.google.com/monitoring/api/resources#tag_k8s_container
+type K8sContainer struct {
+
+	// ProjectID is the identifier of the GCP project associated with this resource.
+	// If empty, the project of the exporter is used.
+	ProjectID string
+
+	// Location is the location of the cluster, such as "aws:us-east-1".
+	Location string
+
+	// ClusterName is the name for the cluster the container is running in.
+	ClusterName string
+
+	// NamespaceName is the name of the cluster namespace the container is running in.
+	NamespaceName string
+
+	// PodName is the name of the pod the container is running in.
+	PodName string
+
+	// ContainerName is the name of the container.
+	ContainerName string
+}
+
+// MonitoredResource returns resource type and resource labels for K8sContainer
+func (k8s *K8sContainer) MonitoredResource() (resType string, labels map[string]string) {
+	labels = map[string]string{
+		"location":       k8s.Location,
+		"cluster_name":   k8s.ClusterName,
+		"namespace_name": k8s.NamespaceName,
+		"pod_name":       k8s.PodName,
+		"container_name": k8s.ContainerName,
+	}
+	if k8s.ProjectID != "" {
+		labels["project_id"] = k8s.ProjectID
+	}
+	return "k8s_container", labels
+}
+
+// GenericTask represents generic_task type monitored resource.
+// For definition refer to
+// https://cloud.google.com/monitoring/api/resources#tag_generic_task
+type GenericTask struct {
+
+	// ProjectID is the identifier of the GCP project associated with this resource.
+	// If empty, the project of the exporter is used.
+	ProjectID string
+
+	// Location is where the task is running, such as "aws:us-east-1a".
+	Location string
+
+	// Namespace is a namespace identifier, such as a cluster name.
+	Namespace string
+
+	// Job is an identifier for a grouping of related tasks, such as the name
+	// of a microservice.
+	Job string
+
+	// TaskID is a unique identifier for the task within the namespace and job.
+	TaskID string
+}
+
+// MonitoredResource returns resource type and resource labels for GenericTask
+func (gt *GenericTask) MonitoredResource() (resType string, labels map[string]string) {
+	labels = map[string]string{
+		"location":  gt.Location,
+		"namespace": gt.Namespace,
+		"job":       gt.Job,
+		"task_id":   gt.TaskID,
+	}
+	if gt.ProjectID != "" {
+		labels["project_id"] = gt.ProjectID
+	}
+	return "generic_task", labels
+}
+
+// GenericNode represents generic_node type monitored resource.
+// For definition refer to
+// https://cloud.google.com/monitoring/api/resources#tag_generic_node
+type GenericNode struct {
+
+	// ProjectID is the identifier of the GCP project associated with this resource.
+	// If empty, the project of the exporter is used.
+	ProjectID string
+
+	// Location is where the node is running, such as "aws:us-east-1".
+	Location string
+
+	// Namespace is a namespace identifier, such as a cluster name.
+	Namespace string
+
+	// NodeID is a unique identifier for the node within the namespace, such
+	// as a hostname or instance ID.
+	NodeID string
+}
+
+// MonitoredResource returns resource type and resource labels for GenericNode
+func (gn *GenericNode) MonitoredResource() (resType string, labels map[string]string) {
+	labels = map[string]string{
+		"location":  gn.Location,
+		"namespace": gn.Namespace,
+		"node_id":   gn.NodeID,
+	}
+	if gn.ProjectID != "" {
+		labels["project_id"] = gn.ProjectID
+	}
+	return "generic_node", labels
+}
+
 // Autodetect auto detects monitored resources based on
 // the environment where the application is running.
 // It supports detection of following resource types
-// 1. gke_container:
-// 2. gce_instance:
-// 3. aws_ec2_instance:
+// 1. cloud_function:
+// 2. gae_instance:
+// 3. cloud_run_revision:
+// 4. gke_container:
+// 5. gce_instance:
+// 6. generic_task: on Amazon ECS
+// 7. k8s_container or generic_node: on Amazon EKS
+// 8. aws_ec2_instance:
+// 9. generic_node: on Azure VMs and other hosts
+//
+// The environment is probed once with the default DetectOptions, see
+// AutodetectContext. In GCP, AWS and Azure environment probing finishes
+// quickly. However, in an environment other than those (e.g local laptop) it
+// takes 2 seconds for GCP and Azure and 5-6 for AWS; use AutodetectContext
+// to bound it.
 //
 // Returns MonitoredResInterface which implements getLabels() and getType()
 // For resource definition go to https://cloud.google.com/monitoring/api/resources
 func Autodetect() Interface {
-	return func() Interface {
-		detectOnce.Do(func() {
-			var awsIdentityDoc *awsIdentityDocument
-			var gcpMetadata *gcpMetadata
-
-			// First attempts to retrieve AWS Identity Doc and GCP metadata.
-			// It then determines the resource type
-			// In GCP and AWS environment both func finishes quickly. However,
-			// in an environment other than those (e.g local laptop) it
-			// takes 2 seconds for GCP and 5-6 for AWS.
-			var wg sync.WaitGroup
-			wg.Add(2)
-
-			go func() {
-				defer wg.Done()
-				awsIdentityDoc = retrieveAWSIdentityDocument()
-			}()
-			go func() {
-				defer wg.Done()
-				gcpMetadata = retrieveGCPMetadata()
-			}()
-
-			wg.Wait()
-			autoDetected = detectResourceType(awsIdentityDoc, gcpMetadata)
-		})
-		return autoDetected
-	}()
-
+	return AutodetectContext(context.Background(), DetectOptions{})
 }
 
 // createAWSEC2InstanceMonitoredResource creates a aws_ec2_instance monitored resource
@@ -183,6 +377,58 @@ func createAWSEC2InstanceMonitoredResource(awsIdentityDoc *awsIdentityDocument)
 	return &awsInstance
 }
 
+// createECSTaskMonitoredResource creates a generic_task monitored resource
+// ecsTask contains ECS task specific attributes.
+func createECSTaskMonitoredResource(ecsTask *ecsTaskMetadata) *GenericTask {
+	location := ecsTask.availabilityZone
+	if location == "" {
+		location = ecsTask.region
+	}
+	job := ecsTask.family
+	if ecsTask.containerName != "" {
+		job = fmt.Sprintf("%s/%s", ecsTask.family, ecsTask.containerName)
+	}
+	genericTask := GenericTask{
+		Location:  fmt.Sprintf("aws:%s", location),
+		Namespace: ecsTask.cluster,
+		Job:       job,
+		TaskID:    ecsTask.taskID,
+	}
+	return &genericTask
+}
+
+// createEKSMonitoredResource creates a k8s_container monitored resource, or a
+// generic_node monitored resource for the node if the pod is not known.
+// awsIdentityDoc contains AWS EC2 attributes. nil on Fargate.
+// Other attributes are derived from the downward API and environment variables,
+// see retrieveK8sPodInfo.
+func createEKSMonitoredResource(awsIdentityDoc *awsIdentityDocument) Interface {
+	region := os.Getenv("AWS_REGION")
+	nodeID, _ := os.Hostname()
+	if awsIdentityDoc != nil {
+		region = awsIdentityDoc.region
+		nodeID = awsIdentityDoc.instanceID
+	}
+	location := fmt.Sprintf("aws:%s", region)
+	clusterName := os.Getenv("CLUSTER_NAME")
+
+	podInfo := retrieveK8sPodInfo()
+	if podInfo.namespace == "" || podInfo.containerName == "" {
+		return &GenericNode{
+			Location:  location,
+			Namespace: namespaceOrDefault(clusterName),
+			NodeID:    nodeID,
+		}
+	}
+	return &K8sContainer{
+		Location:      location,
+		ClusterName:   clusterName,
+		NamespaceName: podInfo.namespace,
+		PodName:       podInfo.podName,
+		ContainerName: podInfo.containerName,
+	}
+}
+
 // createGCEInstanceMonitoredResource creates a gce_instance monitored resource
 // gcpMetadata contains GCP (GKE or GCE) specific attributes.
 func createGCEInstanceMonitoredResource(gcpMetadata *gcpMetadata) *GCEInstance {
@@ -194,6 +440,43 @@ func createGCEInstanceMonitoredResource(gcpMetadata *gcpMetadata) *GCEInstance {
 	return &gceInstance
 }
 
+// createCloudFunctionMonitoredResource creates a cloud_function monitored resource
+// gcpMetadata contains Cloud Functions specific attributes.
+func createCloudFunctionMonitoredResource(gcpMetadata *gcpMetadata) *CloudFunction {
+	cloudFunction := CloudFunction{
+		ProjectID:    gcpMetadata.projectID,
+		FunctionName: gcpMetadata.functionName,
+		Region:       gcpMetadata.region,
+	}
+	return &cloudFunction
+}
+
+// createGAEInstanceMonitoredResource creates a gae_instance monitored resource
+// gcpMetadata contains App Engine specific attributes.
+func createGAEInstanceMonitoredResource(gcpMetadata *gcpMetadata) *GAEInstance {
+	gaeInstance := GAEInstance{
+		ProjectID:  gcpMetadata.projectID,
+		ModuleID:   gcpMetadata.moduleID,
+		VersionID:  gcpMetadata.versionID,
+		InstanceID: gcpMetadata.gaeInstanceID,
+		Location:   gcpMetadata.zone,
+	}
+	return &gaeInstance
+}
+
+// createCloudRunRevisionMonitoredResource creates a cloud_run_revision monitored resource
+// gcpMetadata contains Cloud Run specific attributes.
+func createCloudRunRevisionMonitoredResource(gcpMetadata *gcpMetadata) *CloudRunRevision {
+	cloudRunRevision := CloudRunRevision{
+		ProjectID:         gcpMetadata.projectID,
+		ServiceName:       gcpMetadata.serviceName,
+		RevisionName:      gcpMetadata.revisionName,
+		ConfigurationName: gcpMetadata.configurationName,
+		Location:          gcpMetadata.region,
+	}
+	return &cloudRunRevision
+}
+
 // createGKEContainerMonitoredResource creates a gke_container monitored resource
 // gcpMetadata contains GCP (GKE or GCE) specific attributes.
 func createGKEContainerMonitoredResource(gcpMetadata *gcpMetadata) *GKEContainer {
@@ -201,6 +484,7 @@ func createGKEContainerMonitoredResource(gcpMetadata *gcpMetadata) *GKEContainer
 		ProjectID:                  gcpMetadata.projectID,
 		InstanceID:                 gcpMetadata.instanceID,
 		Zone:                       gcpMetadata.zone,
+		ClusterLocation:            gcpMetadata.clusterLocation,
 		ContainerName:              gcpMetadata.containerName,
 		ClusterName:                gcpMetadata.clusterName,
 		NamespaceID:                gcpMetadata.namespaceID,
@@ -209,24 +493,3 @@ func createGKEContainerMonitoredResource(gcpMetadata *gcpMetadata) *GKEContainer
 	}
 	return &gkeContainer
 }
-
-// detectOnce is used to make sure GCP and AWS metadata detect function executes only once.
-var detectOnce sync.Once
-
-// autoDetected is the metadata detected after the first execution of Autodetect function.
-var autoDetected Interface
-
-// detectResourceType determines the resource type.
-// awsIdentityDoc contains AWS EC2 attributes. nil if it is not AWS EC2 environment
-// gcpMetadata contains GCP (GKE or GCE) specific attributes.
-func detectResourceType(awsIdentityDoc *awsIdentityDocument, gcpMetadata *gcpMetadata) Interface {
-	if os.Getenv("KUBERNETES_SERVICE_HOST") != "" &&
-		gcpMetadata != nil && gcpMetadata.instanceID != "" {
-		return createGKEContainerMonitoredResource(gcpMetadata)
-	} else if gcpMetadata != nil && gcpMetadata.instanceID != "" {
-		return createGCEInstanceMonitoredResource(gcpMetadata)
-	} else if awsIdentityDoc != nil {
-		return createAWSEC2InstanceMonitoredResource(awsIdentityDoc)
-	}
-	return nil
-}
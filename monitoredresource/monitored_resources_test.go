@@ -15,7 +15,13 @@
 package monitoredresource
 
 import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
 	"os"
+	"path/filepath"
+	"strings"
 	"testing"
 )
 
@@ -40,7 +46,7 @@ func TestGKEContainerMonitoredResources(t *testing.T) {
 		namespaceID:   GKENamespaceStr,
 		podID:         GKEPodIDStr,
 	}
-	autoDetected := detectResourceType(nil, &gcpMetadata)
+	autoDetected := detectResourceType(DefaultDetectionOrder, &probeResults{gcp: &gcpMetadata})
 
 	if autoDetected == nil {
 		t.Fatal("GKEContainerMonitoredResource nil")
@@ -70,7 +76,7 @@ func TestGKEContainerMonitoredResourcesV2(t *testing.T) {
 		podID:         GKEPodIDStr,
 		monitoringV2:  true,
 	}
-	autoDetected := detectResourceType(nil, &gcpMetadata)
+	autoDetected := detectResourceType(DefaultDetectionOrder, &probeResults{gcp: &gcpMetadata})
 
 	if autoDetected == nil {
 		t.Fatal("GKEContainerMonitoredResource nil")
@@ -94,7 +100,7 @@ func TestGCEInstanceMonitoredResources(t *testing.T) {
 		projectID:  GCPProjectIDStr,
 		zone:       GCPZoneStr,
 	}
-	autoDetected := detectResourceType(nil, &gcpMetadata)
+	autoDetected := detectResourceType(DefaultDetectionOrder, &probeResults{gcp: &gcpMetadata})
 
 	if autoDetected == nil {
 		t.Fatal("GCEInstanceMonitoredResource nil")
@@ -117,7 +123,7 @@ func TestAWSEC2InstanceMonitoredResources(t *testing.T) {
 		"i-1234567890abcdef0",
 		"us-west-2",
 	}
-	autoDetected := detectResourceType(awsIdentityDoc, &gcpMetadata)
+	autoDetected := detectResourceType(DefaultDetectionOrder, &probeResults{aws: awsIdentityDoc, gcp: &gcpMetadata})
 
 	if autoDetected == nil {
 		t.Fatal("AWSEC2InstanceMonitoredResource nil")
@@ -130,3 +136,338 @@ func TestAWSEC2InstanceMonitoredResources(t *testing.T) {
 		t.Errorf("AWSEC2InstanceMonitoredResource Failed: %v", autoDetected)
 	}
 }
+
+// fakeMetadataServer serves the given metadata paths, relative to
+// /computeMetadata/v1/, and points the metadata client at it until the
+// returned function is called.
+func fakeMetadataServer(t *testing.T, values map[string]string) func() {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Metadata-Flavor") != "Google" {
+			t.Errorf("request to %s without Metadata-Flavor header", r.URL.Path)
+		}
+		v, ok := values[strings.TrimPrefix(r.URL.Path, "/computeMetadata/v1/")]
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		w.Write([]byte(v))
+	}))
+	os.Setenv("GCE_METADATA_HOST", strings.TrimPrefix(srv.URL, "http://"))
+	return func() {
+		os.Unsetenv("GCE_METADATA_HOST")
+		srv.Close()
+	}
+}
+
+func TestCloudRunRevisionMonitoredResources(t *testing.T) {
+	defer fakeMetadataServer(t, map[string]string{
+		"instance/id":        GCPInstanceIDStr,
+		"project/project-id": GCPProjectIDStr,
+		"instance/zone":      "projects/1234/zones/us-central1-1",
+		"instance/region":    "projects/1234/regions/us-central1",
+	})()
+	defer setEnv(map[string]string{
+		"K_SERVICE":       "hello",
+		"K_REVISION":      "hello-00001-abc",
+		"K_CONFIGURATION": "hello",
+	})()
+
+	autoDetected := detectResourceType(DefaultDetectionOrder, &probeResults{gcp: retrieveGCPMetadata(context.Background(), false)})
+
+	if autoDetected == nil {
+		t.Fatal("CloudRunRevisionMonitoredResource nil")
+	}
+	resType, labels := autoDetected.MonitoredResource()
+	if resType != "cloud_run_revision" ||
+		labels["project_id"] != GCPProjectIDStr ||
+		labels["service_name"] != "hello" ||
+		labels["revision_name"] != "hello-00001-abc" ||
+		labels["configuration_name"] != "hello" ||
+		labels["location"] != "us-central1" {
+		t.Errorf("CloudRunRevisionMonitoredResource Failed: %v", autoDetected)
+	}
+}
+
+// setEnv sets the given environment variables until the returned function
+// is called.
+func setEnv(env map[string]string) func() {
+	old := make(map[string]*string)
+	for k, v := range env {
+		if prev, ok := os.LookupEnv(k); ok {
+			old[k] = &prev
+		} else {
+			old[k] = nil
+		}
+		os.Setenv(k, v)
+	}
+	return func() {
+		for k, prev := range old {
+			if prev != nil {
+				os.Setenv(k, *prev)
+			} else {
+				os.Unsetenv(k)
+			}
+		}
+	}
+}
+
+func TestGAEInstanceMonitoredResources(t *testing.T) {
+	defer fakeMetadataServer(t, map[string]string{
+		"instance/id":        GCPInstanceIDStr,
+		"project/project-id": GCPProjectIDStr,
+		"instance/zone":      "projects/1234/zones/us-central1-f",
+	})()
+	defer setEnv(map[string]string{
+		"GAE_SERVICE":  "default",
+		"GAE_VERSION":  "20190801t120000",
+		"GAE_INSTANCE": "00c61b117c",
+	})()
+
+	autoDetected := detectResourceType(DefaultDetectionOrder, &probeResults{gcp: retrieveGCPMetadata(context.Background(), false)})
+
+	if autoDetected == nil {
+		t.Fatal("GAEInstanceMonitoredResource nil")
+	}
+	resType, labels := autoDetected.MonitoredResource()
+	if resType != "gae_instance" ||
+		labels["project_id"] != GCPProjectIDStr ||
+		labels["module_id"] != "default" ||
+		labels["version_id"] != "20190801t120000" ||
+		labels["instance_id"] != "00c61b117c" ||
+		labels["location"] != "us-central1-f" {
+		t.Errorf("GAEInstanceMonitoredResource Failed: %v", autoDetected)
+	}
+}
+
+func TestCloudFunctionMonitoredResources(t *testing.T) {
+	defer fakeMetadataServer(t, map[string]string{
+		"instance/id":        GCPInstanceIDStr,
+		"project/project-id": GCPProjectIDStr,
+		"instance/zone":      "projects/1234/zones/us-central1-1",
+		"instance/region":    "projects/1234/regions/us-central1",
+	})()
+
+	tests := []struct {
+		name       string
+		env        map[string]string
+		wantRegion string
+	}{
+		{
+			name: "newer runtimes",
+			env: map[string]string{
+				"FUNCTION_TARGET": "HelloWorld",
+				"K_SERVICE":       "hello",
+				"K_REVISION":      "1",
+			},
+			wantRegion: "us-central1",
+		},
+		{
+			name: "older runtimes",
+			env: map[string]string{
+				"FUNCTION_TARGET": "HelloWorld",
+				"FUNCTION_NAME":   "hello",
+				"FUNCTION_REGION": "europe-west1",
+			},
+			wantRegion: "europe-west1",
+		},
+		{
+			name: "K_SERVICE before FUNCTION_NAME",
+			env: map[string]string{
+				"FUNCTION_TARGET": "HelloWorld",
+				"K_SERVICE":       "hello",
+				"FUNCTION_NAME":   "other",
+				"FUNCTION_REGION": "europe-west1",
+			},
+			wantRegion: "europe-west1",
+		},
+	}
+	for _, tt := range tests {
+		unset := setEnv(tt.env)
+		autoDetected := detectResourceType(DefaultDetectionOrder, &probeResults{gcp: retrieveGCPMetadata(context.Background(), false)})
+		unset()
+
+		if autoDetected == nil {
+			t.Fatalf("%s: CloudFunctionMonitoredResource nil", tt.name)
+		}
+		resType, labels := autoDetected.MonitoredResource()
+		if resType != "cloud_function" ||
+			labels["project_id"] != GCPProjectIDStr ||
+			labels["function_name"] != "hello" ||
+			labels["region"] != tt.wantRegion {
+			t.Errorf("%s: CloudFunctionMonitoredResource Failed: %v", tt.name, autoDetected)
+		}
+	}
+}
+
+func TestECSTaskMonitoredResources(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/v4/task":
+			w.Write([]byte(`{
+				"Cluster": "arn:aws:ecs:us-west-2:111122223333:cluster/default",
+				"TaskARN": "arn:aws:ecs:us-west-2:111122223333:task/default/158d1c8083dd49d6b527399fd6414f5c",
+				"Family": "curltest",
+				"Revision": "26",
+				"AvailabilityZone": "us-west-2d",
+				"LaunchType": "FARGATE"
+			}`))
+		case "/v4":
+			w.Write([]byte(`{"DockerId": "ea32192c8553fbff06c9340478a2ff089b2bb5646fb718b4ee206641c9086d66", "Name": "curl"}`))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer srv.Close()
+	defer setEnv(map[string]string{"ECS_CONTAINER_METADATA_URI_V4": srv.URL + "/v4"})()
+
+	autoDetected := detectResourceType(DefaultDetectionOrder, &probeResults{ecs: retrieveECSTaskMetadata(context.Background()), gcp: &gcpMetadata{}})
+
+	if autoDetected == nil {
+		t.Fatal("ECSTaskMonitoredResource nil")
+	}
+	resType, labels := autoDetected.MonitoredResource()
+	if resType != "generic_task" ||
+		labels["location"] != "aws:us-west-2d" ||
+		labels["namespace"] != "default" ||
+		labels["job"] != "curltest/curl" ||
+		labels["task_id"] != "158d1c8083dd49d6b527399fd6414f5c" {
+		t.Errorf("ECSTaskMonitoredResource Failed: %v", autoDetected)
+	}
+	if _, ok := labels["project_id"]; ok {
+		t.Errorf("ECSTaskMonitoredResource has a project_id label: %v", labels)
+	}
+}
+
+func TestEKSMonitoredResources(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/latest/meta-data/instance-id":
+			w.Write([]byte("i-1234567890abcdef0"))
+		case "/latest/dynamic/instance-identity/document":
+			w.Write([]byte(`{"accountId": "123456789012", "instanceId": "i-1234567890abcdef0", "region": "us-west-2"}`))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer srv.Close()
+	ec2MetadataEndpoint = srv.URL + "/latest"
+	defer func() { ec2MetadataEndpoint = "" }()
+	defer setEnv(map[string]string{
+		"KUBERNETES_SERVICE_HOST": "127.0.0.1",
+		"CLUSTER_NAME":            "eks-cluster",
+	})()
+
+	awsIdentityDoc := retrieveAWSIdentityDocument(context.Background())
+	autoDetected := detectResourceType(DefaultDetectionOrder, &probeResults{aws: awsIdentityDoc, gcp: &gcpMetadata{}})
+	if autoDetected == nil {
+		t.Fatal("EKS GenericNodeMonitoredResource nil")
+	}
+	resType, labels := autoDetected.MonitoredResource()
+	if resType != "generic_node" ||
+		labels["location"] != "aws:us-west-2" ||
+		labels["namespace"] != "eks-cluster" ||
+		labels["node_id"] != "i-1234567890abcdef0" {
+		t.Errorf("EKS GenericNodeMonitoredResource Failed: %v", autoDetected)
+	}
+
+	defer setEnv(map[string]string{
+		"NAMESPACE":      GKENamespaceStr,
+		"CONTAINER_NAME": GKEContainerNameStr,
+		"HOSTNAME":       GKEPodIDStr,
+	})()
+	autoDetected = detectResourceType(DefaultDetectionOrder, &probeResults{aws: awsIdentityDoc, gcp: &gcpMetadata{}})
+	if autoDetected == nil {
+		t.Fatal("EKS K8sContainerMonitoredResource nil")
+	}
+	resType, labels = autoDetected.MonitoredResource()
+	if resType != "k8s_container" ||
+		labels["location"] != "aws:us-west-2" ||
+		labels["cluster_name"] != "eks-cluster" ||
+		labels["namespace_name"] != GKENamespaceStr ||
+		labels["pod_name"] != GKEPodIDStr ||
+		labels["container_name"] != GKEContainerNameStr {
+		t.Errorf("EKS K8sContainerMonitoredResource Failed: %v", autoDetected)
+	}
+}
+
+func TestK8sContainerFromDownwardAPI(t *testing.T) {
+	defer fakeMetadataServer(t, map[string]string{
+		"instance/id":                          GCPInstanceIDStr,
+		"project/project-id":                   GCPProjectIDStr,
+		"instance/zone":                        "projects/1234/zones/us-central1-a",
+		"instance/attributes/cluster-name":     GKEClusterNameStr,
+		"instance/attributes/cluster-location": "us-central1",
+	})()
+
+	dir, err := ioutil.TempDir("", "podinfo")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	for name, content := range map[string]string{
+		"name":      GKEPodIDStr + "\n",
+		"namespace": GKENamespaceStr + "\n",
+	} {
+		if err := ioutil.WriteFile(filepath.Join(dir, name), []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	oldPodInfoDir := podInfoDir
+	podInfoDir = dir
+	defer func() { podInfoDir = oldPodInfoDir }()
+	defer setEnv(map[string]string{
+		"KUBERNETES_SERVICE_HOST": "127.0.0.1",
+		"CONTAINER_NAME":          GKEContainerNameStr,
+		"HOSTNAME":                "hostname",
+	})()
+
+	// The GKE API is not called, so detection succeeds without credentials
+	// or network access.
+	autoDetected := detectResourceType(DefaultDetectionOrder, &probeResults{gcp: retrieveGCPMetadata(context.Background(), false)})
+
+	if autoDetected == nil {
+		t.Fatal("GKEContainerMonitoredResource nil")
+	}
+	resType, labels := autoDetected.MonitoredResource()
+	if resType != "k8s_container" ||
+		labels["project_id"] != GCPProjectIDStr ||
+		labels["cluster_name"] != GKEClusterNameStr ||
+		labels["container_name"] != GKEContainerNameStr ||
+		labels["location"] != "us-central1" ||
+		labels["namespace_name"] != GKENamespaceStr ||
+		labels["pod_name"] != GKEPodIDStr {
+		t.Errorf("GKEContainerMonitoredResource from downward API Failed: %v", autoDetected)
+	}
+}
+
+func TestK8sPodInfoPrecedence(t *testing.T) {
+	dir, err := ioutil.TempDir("", "serviceaccount")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	if err := ioutil.WriteFile(filepath.Join(dir, "namespace"), []byte("from-service-account"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	oldPodInfoDir, oldServiceAccountDir := podInfoDir, serviceAccountDir
+	podInfoDir, serviceAccountDir = filepath.Join(dir, "missing"), dir
+	defer func() { podInfoDir, serviceAccountDir = oldPodInfoDir, oldServiceAccountDir }()
+	defer setEnv(map[string]string{
+		"POD_NAME":         "from-env",
+		"HOSTNAME":         "from-hostname",
+		"POD_NAMESPACE":    "",
+		"NAMESPACE":        "",
+		"CLUSTER_LOCATION": "europe-west1",
+	})()
+
+	got := retrieveK8sPodInfo()
+	want := &k8sPodInfo{
+		podName:         "from-env",
+		namespace:       "from-service-account",
+		containerName:   os.Getenv("CONTAINER_NAME"),
+		clusterLocation: "europe-west1",
+	}
+	if *got != *want {
+		t.Errorf("retrieveK8sPodInfo() = %+v; want %+v", got, want)
+	}
+}
@@ -0,0 +1,287 @@
+// Copyright 2019, OpenCensus Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package stackdriver
+
+import (
+	"fmt"
+	"regexp"
+
+	"go.opencensus.io/trace"
+)
+
+// RedactionAction determines how a value matched by a RedactionRule is
+// scrubbed.
+type RedactionAction int
+
+const (
+	// RedactMask replaces the sensitive value with "[REDACTED]".
+	RedactMask RedactionAction = iota
+	// RedactHash replaces the sensitive value with the hex encoded SHA-256
+	// digest of the value, keyed with RedactionRule.HashKey if set. As for
+	// AttributeHash, digests without a key are not anonymisation.
+	RedactHash
+	// RedactDrop removes the attribute carrying the sensitive value. For
+	// annotation and status messages the whole message is cleared.
+	RedactDrop
+)
+
+const redactedValue = "[REDACTED]"
+
+// RedactionRule describes sensitive data to be scrubbed from spans before
+// they are exported to Stackdriver Trace.
+//
+// A rule applies to span attributes, annotation attributes, link attributes,
+// annotation messages and the status message.
+type RedactionRule struct {
+	// Name identifies the rule in RedactionReport counts.
+	Name string
+
+	// Keys restricts the rule to attributes with one of these keys.
+	// Rules with Keys set never apply to messages.
+	// If Pattern is nil, the whole value of a matching attribute is redacted.
+	Keys []string
+
+	// Pattern matches the sensitive parts of string values.
+	Pattern *regexp.Regexp
+
+	// Validate, if set, is called for each Pattern match and may reject
+	// false positives by returning false.
+	Validate func(match string) bool
+
+	// Action determines how matched values are scrubbed.
+	Action RedactionAction
+
+	// HashKey is the secret key of the HMAC-SHA256 used by RedactHash.
+	// Optional.
+	HashKey []byte
+}
+
+// RedactionReport lists how many values each RedactionRule scrubbed from
+// a single span.
+type RedactionReport struct {
+	SpanContext trace.SpanContext
+	Name        string
+
+	// Counts maps a rule name to the number of values it redacted.
+	Counts map[string]int
+}
+
+var (
+	// EmailRedactionRule masks email addresses.
+	EmailRedactionRule = RedactionRule{
+		Name:    "email",
+		Pattern: regexp.MustCompile(`[A-Za-z0-9._%+\-]+@[A-Za-z0-9.\-]+\.[A-Za-z]{2,}`),
+	}
+
+	// BearerTokenRedactionRule masks bearer tokens, e.g. from Authorization headers.
+	BearerTokenRedactionRule = RedactionRule{
+		Name:    "bearer_token",
+		Pattern: regexp.MustCompile(`(?i)bearer\s+[A-Za-z0-9\-._~+/]+=*`),
+	}
+
+	// CreditCardRedactionRule masks credit card numbers that pass the Luhn check.
+	CreditCardRedactionRule = RedactionRule{
+		Name:     "credit_card",
+		Pattern:  regexp.MustCompile(`\b(?:\d[ \-]?){12,18}\d\b`),
+		Validate: luhnValid,
+	}
+
+	// IPAddressRedactionRule masks IPv4 and IPv6 addresses.
+	IPAddressRedactionRule = RedactionRule{
+		Name:    "ip_address",
+		Pattern: regexp.MustCompile(`\b(?:(?:25[0-5]|2[0-4]\d|1?\d?\d)\.){3}(?:25[0-5]|2[0-4]\d|1?\d?\d)\b|\b(?:[0-9A-Fa-f]{1,4}:){7}[0-9A-Fa-f]{1,4}\b`),
+	}
+
+	// DefaultRedactionRules contains all built-in detectors.
+	DefaultRedactionRules = []RedactionRule{
+		EmailRedactionRule,
+		BearerTokenRedactionRule,
+		CreditCardRedactionRule,
+		IPAddressRedactionRule,
+	}
+)
+
+// luhnValid reports whether the digits in s pass the Luhn checksum.
+func luhnValid(s string) bool {
+	var sum, n int
+	double := false
+	for i := len(s) - 1; i >= 0; i-- {
+		c := s[i]
+		if c < '0' || c > '9' {
+			continue
+		}
+		d := int(c - '0')
+		if double {
+			d *= 2
+			if d > 9 {
+				d -= 9
+			}
+		}
+		sum += d
+		double = !double
+		n++
+	}
+	return n >= 13 && sum%10 == 0
+}
+
+// redactor applies a list of RedactionRules to spans.
+type redactor struct {
+	rules    []RedactionRule
+	keys     []map[string]bool
+	onReport func(RedactionReport)
+}
+
+func newRedactor(rules []RedactionRule, onReport func(RedactionReport)) *redactor {
+	r := &redactor{
+		rules:    rules,
+		keys:     make([]map[string]bool, len(rules)),
+		onReport: onReport,
+	}
+	for i, rule := range rules {
+		if len(rule.Keys) == 0 {
+			continue
+		}
+		r.keys[i] = make(map[string]bool, len(rule.Keys))
+		for _, k := range rule.Keys {
+			r.keys[i][k] = true
+		}
+	}
+	return r
+}
+
+// redact returns a copy of sd with sensitive data scrubbed. sd itself is
+// not modified. If nothing was redacted, sd is returned as is.
+func (r *redactor) redact(sd *trace.SpanData) *trace.SpanData {
+	counts := make(map[string]int)
+	newSD := *sd
+	newSD.Attributes = r.redactAttributes(sd.Attributes, counts)
+	newSD.Status.Message = r.redactMessage(sd.Status.Message, counts)
+	if len(sd.Annotations) > 0 {
+		newSD.Annotations = make([]trace.Annotation, len(sd.Annotations))
+		for i, a := range sd.Annotations {
+			a.Message = r.redactMessage(a.Message, counts)
+			a.Attributes = r.redactAttributes(a.Attributes, counts)
+			newSD.Annotations[i] = a
+		}
+	}
+	if len(sd.Links) > 0 {
+		newSD.Links = make([]trace.Link, len(sd.Links))
+		for i, l := range sd.Links {
+			l.Attributes = r.redactAttributes(l.Attributes, counts)
+			newSD.Links[i] = l
+		}
+	}
+	if len(counts) == 0 {
+		return sd
+	}
+	if r.onReport != nil {
+		r.onReport(RedactionReport{
+			SpanContext: sd.SpanContext,
+			Name:        sd.Name,
+			Counts:      counts,
+		})
+	}
+	return &newSD
+}
+
+func (r *redactor) redactAttributes(in map[string]interface{}, counts map[string]int) map[string]interface{} {
+	if len(in) == 0 {
+		return in
+	}
+	out := make(map[string]interface{}, len(in))
+	for k, v := range in {
+		if v, ok := r.redactAttribute(k, v, counts); ok {
+			out[k] = v
+		}
+	}
+	return out
+}
+
+// redactAttribute returns the scrubbed attribute value, or ok == false if
+// the attribute must be dropped.
+func (r *redactor) redactAttribute(key string, value interface{}, counts map[string]int) (interface{}, bool) {
+	for i, rule := range r.rules {
+		if r.keys[i] != nil && !r.keys[i][key] {
+			continue
+		}
+		if rule.Pattern == nil {
+			if r.keys[i] == nil {
+				continue
+			}
+			counts[rule.Name]++
+			switch rule.Action {
+			case RedactDrop:
+				return nil, false
+			case RedactHash:
+				value = hashString(rule.HashKey, fmt.Sprint(value))
+			default:
+				value = redactedValue
+			}
+			continue
+		}
+		s, ok := value.(string)
+		if !ok {
+			continue
+		}
+		s, n := r.apply(rule, s)
+		if n == 0 {
+			continue
+		}
+		counts[rule.Name] += n
+		if rule.Action == RedactDrop {
+			return nil, false
+		}
+		value = s
+	}
+	return value, true
+}
+
+func (r *redactor) redactMessage(msg string, counts map[string]int) string {
+	if msg == "" {
+		return msg
+	}
+	for i, rule := range r.rules {
+		if r.keys[i] != nil || rule.Pattern == nil {
+			continue
+		}
+		s, n := r.apply(rule, msg)
+		if n == 0 {
+			continue
+		}
+		counts[rule.Name] += n
+		if rule.Action == RedactDrop {
+			return ""
+		}
+		msg = s
+	}
+	return msg
+}
+
+// apply replaces all matches of rule.Pattern in s and returns the result
+// together with the number of replaced matches.
+func (r *redactor) apply(rule RedactionRule, s string) (string, int) {
+	var n int
+	out := rule.Pattern.ReplaceAllStringFunc(s, func(match string) string {
+		if rule.Validate != nil && !rule.Validate(match) {
+			return match
+		}
+		n++
+		if rule.Action == RedactHash {
+			return hashString(rule.HashKey, match)
+		}
+		return redactedValue
+	})
+	return out, n
+}
@@ -0,0 +1,132 @@
+// Copyright 2019, OpenCensus Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package stackdriver
+
+import (
+	"reflect"
+	"testing"
+
+	"go.opencensus.io/trace"
+)
+
+func TestRedact(t *testing.T) {
+	var reports []RedactionReport
+	rules := append([]RedactionRule{
+		{Name: "password", Keys: []string{"password"}, Action: RedactDrop},
+		{Name: "user", Keys: []string{"user.id"}, Action: RedactHash},
+	}, DefaultRedactionRules...)
+	r := newRedactor(rules, func(rr RedactionReport) {
+		reports = append(reports, rr)
+	})
+
+	sd := &trace.SpanData{
+		Name: "span",
+		Attributes: map[string]interface{}{
+			"password": "hunter2",
+			"user.id":  int64(42),
+			"auth":     "Bearer abc.def-ghi",
+			"client":   "10.0.0.1 and 10.0.0.2",
+			"card":     "4111 1111 1111 1111",
+			"order":    "1234567890123",
+			"count":    int64(3),
+		},
+		Annotations: []trace.Annotation{
+			{Message: "mail sent to jane@example.com", Attributes: map[string]interface{}{"to": "joe@example.com"}},
+		},
+		Links: []trace.Link{
+			{Attributes: map[string]interface{}{"peer": "192.168.1.1"}},
+		},
+		Status: trace.Status{Code: 2, Message: "user jane@example.com not found"},
+	}
+	got := r.redact(sd)
+
+	wantAttrs := map[string]interface{}{
+		"user.id": hashString(nil, "42"),
+		"auth":    "[REDACTED]",
+		"client":  "[REDACTED] and [REDACTED]",
+		"card":    "[REDACTED]",
+		"order":   "1234567890123",
+		"count":   int64(3),
+	}
+	if !reflect.DeepEqual(got.Attributes, wantAttrs) {
+		t.Errorf("Attributes = %v; want %v", got.Attributes, wantAttrs)
+	}
+	if want := "mail sent to [REDACTED]"; got.Annotations[0].Message != want {
+		t.Errorf("Annotation message = %q; want %q", got.Annotations[0].Message, want)
+	}
+	if want := "[REDACTED]"; got.Annotations[0].Attributes["to"] != want {
+		t.Errorf("Annotation attribute = %q; want %q", got.Annotations[0].Attributes["to"], want)
+	}
+	if want := "[REDACTED]"; got.Links[0].Attributes["peer"] != want {
+		t.Errorf("Link attribute = %q; want %q", got.Links[0].Attributes["peer"], want)
+	}
+	if want := "user [REDACTED] not found"; got.Status.Message != want {
+		t.Errorf("Status message = %q; want %q", got.Status.Message, want)
+	}
+	if sd.Attributes["password"] != "hunter2" || sd.Annotations[0].Message != "mail sent to jane@example.com" {
+		t.Errorf("redact modified the original span data")
+	}
+
+	if len(reports) != 1 {
+		t.Fatalf("got %d reports; want 1", len(reports))
+	}
+	wantCounts := map[string]int{
+		"password":     1,
+		"user":         1,
+		"bearer_token": 1,
+		"ip_address":   3,
+		"credit_card":  1,
+		"email":        3,
+	}
+	if !reflect.DeepEqual(reports[0].Counts, wantCounts) {
+		t.Errorf("Counts = %v; want %v", reports[0].Counts, wantCounts)
+	}
+}
+
+func TestRedactNothing(t *testing.T) {
+	r := newRedactor(DefaultRedactionRules, func(RedactionReport) {
+		t.Error("unexpected report")
+	})
+	sd := &trace.SpanData{
+		Name:       "span",
+		Attributes: map[string]interface{}{"k": "v"},
+	}
+	if got := r.redact(sd); got != sd {
+		t.Errorf("redact returned a copy of span data without sensitive values")
+	}
+}
+
+func TestRedactKeyedHash(t *testing.T) {
+	card := CreditCardRedactionRule
+	card.Action = RedactHash
+	card.HashKey = []byte("secret")
+	r := newRedactor([]RedactionRule{
+		card,
+		{Name: "message", Keys: []string{"message"}, Action: RedactHash, HashKey: []byte("Jefe")},
+	}, nil)
+	got := r.redact(&trace.SpanData{
+		Attributes: map[string]interface{}{
+			"card":    "4111111111111111",
+			"message": "what do ya want for nothing?",
+		},
+	})
+	// HMAC-SHA256 test case 2 of RFC 4231.
+	if want := "5bdcc146bf60754e6a042426089575c75a003f089d2739839dec58b964ec3843"; got.Attributes["message"] != want {
+		t.Errorf("message = %v; want %v", got.Attributes["message"], want)
+	}
+	if v := got.Attributes["card"]; v == hashString(nil, "4111111111111111") || v == "4111111111111111" {
+		t.Errorf("card = %v; want a keyed hash", v)
+	}
+}
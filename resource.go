@@ -16,18 +16,15 @@ package stackdriver // import "contrib.go.opencensus.io/exporter/stackdriver"
 
 import (
 	"fmt"
+	"sort"
+	"sync"
 
 	"go.opencensus.io/resource"
 	"go.opencensus.io/resource/resourcekeys"
 	monitoredrespb "google.golang.org/genproto/googleapis/api/monitoredres"
-)
 
-type resourceMap struct {
-	// Mapping from the input resource type to the monitored resource type in Stackdriver.
-	srcType, dstType string
-	// Mapping from Stackdriver monitored resource label to an OpenCensus resource label.
-	labels map[string]string
-}
+	"contrib.go.opencensus.io/exporter/stackdriver/internal/gcpenv"
+)
 
 // Resource labels that are generally internal to the exporter.
 // Consider exposing these labels and a type identifier in the future to allow
@@ -38,8 +35,248 @@ const (
 	stackdriverGenericTaskNamespace = "contrib.opencensus.io/exporter/stackdriver/generic_task/namespace"
 	stackdriverGenericTaskJob       = "contrib.opencensus.io/exporter/stackdriver/generic_task/job"
 	stackdriverGenericTaskID        = "contrib.opencensus.io/exporter/stackdriver/generic_task/task_id"
+
+	stackdriverCloudRunService       = "contrib.opencensus.io/exporter/stackdriver/cloud_run_revision/service_name"
+	stackdriverCloudRunRevision      = "contrib.opencensus.io/exporter/stackdriver/cloud_run_revision/revision_name"
+	stackdriverCloudRunConfiguration = "contrib.opencensus.io/exporter/stackdriver/cloud_run_revision/configuration_name"
+
+	stackdriverGAEModuleID       = "contrib.opencensus.io/exporter/stackdriver/gae_instance/module_id"
+	stackdriverGAEVersionID      = "contrib.opencensus.io/exporter/stackdriver/gae_instance/version_id"
+	stackdriverGAEInstanceID     = "contrib.opencensus.io/exporter/stackdriver/gae_instance/instance_id"
+	stackdriverCloudFunctionName = "contrib.opencensus.io/exporter/stackdriver/cloud_function/function_name"
 )
 
+// ResourceMapping maps OpenCensus resources to a Stackdriver monitored
+// resource type. Register it with a ResourceMappings registry, such as
+// DefaultResourceMappings.
+type ResourceMapping struct {
+	// Type is the Stackdriver monitored resource type, such as "k8s_container".
+	Type string
+
+	// Match reports whether the mapping applies to a resource. The mapping
+	// only applies if the resource also has all RequiredLabels.
+	// Optional. By default only RequiredLabels are checked.
+	Match func(*resource.Resource) bool
+
+	// RequiredLabels maps monitored resource labels to the OpenCensus
+	// resource labels their values are taken from. The mapping only applies
+	// to resources that have all of these labels.
+	// Optional.
+	RequiredLabels map[string]string
+
+	// OptionalLabels maps monitored resource labels to OpenCensus resource
+	// labels like RequiredLabels, but the labels are only copied if present.
+	// Optional.
+	OptionalLabels map[string]string
+
+	// Transforms rewrite the values of monitored resource labels after they
+	// are copied, such as to add the "aws:" prefix to AWS regions. A
+	// transform is called with the copied value, or "" if the label was not
+	// copied, and the resource; the label is left out if it returns "".
+	// Optional.
+	Transforms map[string]func(value string, res *resource.Resource) string
+
+	// Priority orders the mappings of a registry: the applicable mapping
+	// with the highest priority is used, and mappings of equal priority are
+	// tried in the order they were registered. The built-in mappings have
+	// priorities from 100 to 800.
+	// Optional.
+	Priority int
+}
+
+// applies reports whether m applies to res.
+func (m *ResourceMapping) applies(res *resource.Resource) bool {
+	for _, src := range m.RequiredLabels {
+		if _, ok := res.Labels[src]; !ok {
+			return false
+		}
+	}
+	return m.Match == nil || m.Match(res)
+}
+
+// mapResource returns the monitored resource for res.
+func (m *ResourceMapping) mapResource(res *resource.Resource) *monitoredrespb.MonitoredResource {
+	labels := transformResource(m.RequiredLabels, res.Labels)
+	for dst, v := range transformResource(m.OptionalLabels, res.Labels) {
+		labels[dst] = v
+	}
+	for dst, transform := range m.Transforms {
+		if v := transform(labels[dst], res); v != "" {
+			labels[dst] = v
+		} else {
+			delete(labels, dst)
+		}
+	}
+	return &monitoredrespb.MonitoredResource{
+		Type:   m.Type,
+		Labels: labels,
+	}
+}
+
+// ResourceMappings is a registry of ResourceMappings. It is safe for
+// concurrent use.
+type ResourceMappings struct {
+	mu       sync.RWMutex
+	mappings []*ResourceMapping
+}
+
+// NewResourceMappings returns a registry holding the given mappings.
+func NewResourceMappings(mappings ...ResourceMapping) *ResourceMappings {
+	r := &ResourceMappings{}
+	for _, m := range mappings {
+		r.Register(m)
+	}
+	return r
+}
+
+// Register adds m to the registry.
+func (r *ResourceMappings) Register(m ResourceMapping) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.mappings = append(r.mappings, &m)
+	sort.SliceStable(r.mappings, func(i, j int) bool {
+		return r.mappings[i].Priority > r.mappings[j].Priority
+	})
+}
+
+// MapResource converts res to a Stackdriver monitored resource using the
+// applicable mapping with the highest priority. Resources to which no
+// mapping applies are mapped to the global type, and nil resources or
+// resources without labels to global without labels. It can be used as
+// Options.MapResource.
+func (r *ResourceMappings) MapResource(res *resource.Resource) *monitoredrespb.MonitoredResource {
+	if res == nil || res.Labels == nil {
+		return &monitoredrespb.MonitoredResource{
+			Type: "global",
+		}
+	}
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	for _, m := range r.mappings {
+		if m.applies(res) {
+			return m.mapResource(res)
+		}
+	}
+	return &monitoredrespb.MonitoredResource{
+		Type:   "global",
+		Labels: transformResource(genericResourceMap, res.Labels),
+	}
+}
+
+// DefaultResourceMappings holds the mappings used by the exporter when
+// Options.MapResource is not set. It initially holds the mappings for the
+// well-known OpenCensus resources described in RESOURCE.md; register more
+// mappings to support other monitored resource types.
+var DefaultResourceMappings = NewResourceMappings(
+	ResourceMapping{
+		Type:           "k8s_container",
+		Match:          resourceTypeIs(resourcekeys.ContainerType),
+		OptionalLabels: k8sResourceMap,
+		Transforms:     awsLocationTransforms,
+		Priority:       800,
+	},
+	ResourceMapping{
+		Type:           "k8s_pod",
+		Match:          resourceTypeIs(resourcekeys.K8SType),
+		OptionalLabels: k8sResourceMap,
+		Transforms:     awsLocationTransforms,
+		Priority:       700,
+	},
+	ResourceMapping{
+		Type:           "k8s_node",
+		Match:          resourceTypeIs(resourcekeys.HostType),
+		RequiredLabels: map[string]string{"cluster_name": resourcekeys.K8SKeyClusterName},
+		OptionalLabels: k8sResourceMap,
+		Transforms:     awsLocationTransforms,
+		Priority:       600,
+	},
+	ResourceMapping{
+		Type:           "cloud_function",
+		RequiredLabels: map[string]string{"function_name": stackdriverCloudFunctionName},
+		OptionalLabels: cloudFunctionResourceMap,
+		Priority:       500,
+	},
+	ResourceMapping{
+		Type:           "gae_instance",
+		RequiredLabels: map[string]string{"module_id": stackdriverGAEModuleID},
+		OptionalLabels: gaeResourceMap,
+		Priority:       400,
+	},
+	ResourceMapping{
+		Type:           "cloud_run_revision",
+		RequiredLabels: map[string]string{"service_name": stackdriverCloudRunService},
+		OptionalLabels: cloudRunResourceMap,
+		Priority:       300,
+	},
+	ResourceMapping{
+		Type:           "gce_instance",
+		Match:          cloudProviderIs(resourcekeys.CloudProviderGCP),
+		OptionalLabels: gcpResourceMap,
+		Priority:       200,
+	},
+	ResourceMapping{
+		Type:           "aws_ec2_instance",
+		Match:          cloudProviderIs(resourcekeys.CloudProviderAWS),
+		OptionalLabels: awsResourceMap,
+		Transforms: map[string]func(string, *resource.Resource) string{
+			"region": awsPrefix,
+		},
+		Priority: 100,
+	},
+)
+
+// setServerlessResourceLabels sets the internal labels of the
+// cloud_function, gae_instance and cloud_run_revision resources from the
+// environment variables set by Cloud Functions, App Engine and Cloud Run.
+func setServerlessResourceLabels(labels map[string]string) {
+	env := gcpenv.DetectServerless()
+	switch {
+	case env.FunctionName != "":
+		labels[stackdriverCloudFunctionName] = env.FunctionName
+	case env.GAEService != "":
+		labels[stackdriverGAEModuleID] = env.GAEService
+		labels[stackdriverGAEVersionID] = env.GAEVersion
+		labels[stackdriverGAEInstanceID] = env.GAEInstance
+	case env.RunService != "":
+		labels[stackdriverCloudRunService] = env.RunService
+		labels[stackdriverCloudRunRevision] = env.RunRevision
+		labels[stackdriverCloudRunConfiguration] = env.RunConfiguration
+	}
+}
+
+func resourceTypeIs(typ string) func(*resource.Resource) bool {
+	return func(res *resource.Resource) bool {
+		return res.Type == typ
+	}
+}
+
+func cloudProviderIs(provider string) func(*resource.Resource) bool {
+	return func(res *resource.Resource) bool {
+		return res.Labels[resourcekeys.CloudKeyProvider] == provider
+	}
+}
+
+func awsPrefix(v string, _ *resource.Resource) string {
+	if v == "" {
+		return ""
+	}
+	return fmt.Sprintf("aws:%s", v)
+}
+
+// Kubernetes clusters on AWS, such as Amazon EKS, are located by
+// "aws:<zone>" or "aws:<region>".
+var awsLocationTransforms = map[string]func(string, *resource.Resource) string{
+	"location": func(v string, res *resource.Resource) string {
+		if res.Labels[resourcekeys.CloudKeyProvider] != resourcekeys.CloudProviderAWS {
+			return v
+		}
+		if v == "" {
+			v = res.Labels[resourcekeys.CloudKeyRegion]
+		}
+		return awsPrefix(v, res)
+	},
+}
+
 // Mappings for the well-known OpenCensus resources to applicable Stackdriver resources.
 var k8sResourceMap = map[string]string{
 	"project_id":     stackdriverProjectID,
@@ -57,6 +294,25 @@ var gcpResourceMap = map[string]string{
 	"zone":        resourcekeys.CloudKeyZone,
 }
 
+var cloudRunResourceMap = map[string]string{
+	"project_id":         stackdriverProjectID,
+	"location":           resourcekeys.CloudKeyRegion,
+	"revision_name":      stackdriverCloudRunRevision,
+	"configuration_name": stackdriverCloudRunConfiguration,
+}
+
+var gaeResourceMap = map[string]string{
+	"project_id":  stackdriverProjectID,
+	"location":    resourcekeys.CloudKeyZone,
+	"version_id":  stackdriverGAEVersionID,
+	"instance_id": stackdriverGAEInstanceID,
+}
+
+var cloudFunctionResourceMap = map[string]string{
+	"project_id": stackdriverProjectID,
+	"region":     resourcekeys.CloudKeyRegion,
+}
+
 var awsResourceMap = map[string]string{
 	"project_id":  stackdriverProjectID,
 	"instance_id": resourcekeys.HostKeyID,
@@ -84,37 +340,5 @@ func transformResource(match, input map[string]string) map[string]string {
 }
 
 func defaultMapResource(res *resource.Resource) *monitoredrespb.MonitoredResource {
-	match := genericResourceMap
-	result := &monitoredrespb.MonitoredResource{
-		Type: "global",
-	}
-	if res == nil || res.Labels == nil {
-		return result
-	}
-
-	switch {
-	case res.Type == resourcekeys.ContainerType:
-		result.Type = "k8s_container"
-		match = k8sResourceMap
-	case res.Type == resourcekeys.K8SType:
-		result.Type = "k8s_pod"
-		match = k8sResourceMap
-	case res.Type == resourcekeys.HostType && res.Labels[resourcekeys.K8SKeyClusterName] != "":
-		result.Type = "k8s_node"
-		match = k8sResourceMap
-	case res.Labels[resourcekeys.CloudKeyProvider] == resourcekeys.CloudProviderGCP:
-		result.Type = "gce_instance"
-		match = gcpResourceMap
-	case res.Labels[resourcekeys.CloudKeyProvider] == resourcekeys.CloudProviderAWS:
-		result.Type = "aws_ec2_instance"
-		match = awsResourceMap
-	}
-
-	result.Labels = transformResource(match, res.Labels)
-	if result.Type == "aws_ec2_instance" {
-		if v, ok := result.Labels["region"]; ok {
-			result.Labels["region"] = fmt.Sprintf("aws:%s", v)
-		}
-	}
-	return result
+	return DefaultResourceMappings.MapResource(res)
 }
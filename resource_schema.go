@@ -0,0 +1,152 @@
+// Copyright 2019, OpenCensus Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package stackdriver
+
+import (
+	"fmt"
+	"os"
+	"path"
+	"sort"
+	"strings"
+	"sync"
+
+	monitoredrespb "google.golang.org/genproto/googleapis/api/monitoredres"
+)
+
+// RequiredResourceLabels lists the labels that Stackdriver Monitoring
+// requires for common monitored resource types, see
+// https://cloud.google.com/monitoring/api/resources. The project_id label is
+// left out because it defaults to the project the time series are written
+// to.
+//
+// Stackdriver Monitoring rejects a whole request if one of its time series
+// has a resource that lacks a required label. The exporter therefore checks
+// the resources of time series against this table, and replaces those that
+// lack a required label, or have it empty, by a generic_task resource, or by
+// the global resource if Options.Location is not set. Each replaced resource
+// is reported through OnError the first time it is used.
+//
+// Add entries to check other types. Types that are not listed are not
+// checked. It must not be modified concurrently with exporting.
+var RequiredResourceLabels = map[string][]string{
+	"aws_ec2_instance":   {"instance_id", "region", "aws_account"},
+	"cloud_function":     {"function_name", "region"},
+	"cloud_run_revision": {"service_name", "revision_name", "configuration_name", "location"},
+	"gae_instance":       {"module_id", "version_id", "instance_id", "location"},
+	"gce_instance":       {"instance_id", "zone"},
+	"generic_node":       {"location", "namespace", "node_id"},
+	"generic_task":       {"location", "namespace", "job", "task_id"},
+	"gke_container":      {"cluster_name", "namespace_id", "instance_id", "pod_id", "container_name", "zone"},
+	"k8s_container":      {"location", "cluster_name", "namespace_name", "pod_name", "container_name"},
+	"k8s_node":           {"location", "cluster_name", "node_name"},
+	"k8s_pod":            {"location", "cluster_name", "namespace_name", "pod_name"},
+}
+
+// missingResourceLabels returns the required labels that mr lacks or has
+// empty.
+func missingResourceLabels(mr *monitoredrespb.MonitoredResource) []string {
+	var missing []string
+	for _, k := range RequiredResourceLabels[mr.Type] {
+		if mr.Labels[k] == "" {
+			missing = append(missing, k)
+		}
+	}
+	return missing
+}
+
+// maxInvalidResources bounds the number of invalid resources remembered by a
+// resourceValidator. When it is reached, the validator forgets them and
+// reports them again.
+const maxInvalidResources = 1000
+
+// resourceValidator replaces monitored resources that lack required labels.
+// Each distinct invalid resource is reported only once.
+type resourceValidator struct {
+	location string
+	onError  func(error)
+
+	mu       sync.Mutex
+	replaced map[string]*monitoredrespb.MonitoredResource // Replacements of invalid resources by resourceKey
+}
+
+func newResourceValidator(o Options) *resourceValidator {
+	return &resourceValidator{
+		location: o.Location,
+		onError:  o.handleError,
+		replaced: make(map[string]*monitoredrespb.MonitoredResource),
+	}
+}
+
+// validate returns mr, or the resource replacing it if it lacks required
+// labels. A nil validator returns mr.
+func (v *resourceValidator) validate(mr *monitoredrespb.MonitoredResource) *monitoredrespb.MonitoredResource {
+	if v == nil || mr == nil || len(RequiredResourceLabels[mr.Type]) == 0 {
+		return mr
+	}
+	missing := missingResourceLabels(mr)
+	if len(missing) == 0 {
+		return mr
+	}
+	key := resourceKey(mr)
+	v.mu.Lock()
+	if replaced, ok := v.replaced[key]; ok {
+		v.mu.Unlock()
+		return replaced
+	}
+	replaced := v.fallback(mr)
+	if len(v.replaced) >= maxInvalidResources {
+		v.replaced = make(map[string]*monitoredrespb.MonitoredResource)
+	}
+	v.replaced[key] = replaced
+	v.mu.Unlock()
+
+	// OnError is called without holding the lock, as it may be slow or
+	// export data itself.
+	v.onError(fmt.Errorf("stackdriver: monitored resource %s%v lacks required labels %s, using %s instead",
+		mr.Type, mr.Labels, strings.Join(missing, ", "), replaced.Type))
+	return replaced
+}
+
+// fallback returns the resource replacing mr: a generic_task for this
+// process if the location is known, or the global resource.
+func (v *resourceValidator) fallback(mr *monitoredrespb.MonitoredResource) *monitoredrespb.MonitoredResource {
+	labels := make(map[string]string)
+	if p := mr.Labels["project_id"]; p != "" {
+		labels["project_id"] = p
+	}
+	if v.location == "" {
+		return &monitoredrespb.MonitoredResource{Type: "global", Labels: labels}
+	}
+	labels["location"] = v.location
+	labels["namespace"] = "default"
+	labels["job"] = path.Base(os.Args[0])
+	labels["task_id"] = getTaskValue()
+	return &monitoredrespb.MonitoredResource{Type: "generic_task", Labels: labels}
+}
+
+// resourceKey identifies a monitored resource by its type and labels.
+func resourceKey(mr *monitoredrespb.MonitoredResource) string {
+	keys := make([]string, 0, len(mr.Labels))
+	for k := range mr.Labels {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	var b strings.Builder
+	b.WriteString(mr.Type)
+	for _, k := range keys {
+		fmt.Fprintf(&b, "\x00%s=%s", k, mr.Labels[k])
+	}
+	return b.String()
+}
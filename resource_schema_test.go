@@ -0,0 +1,166 @@
+// Copyright 2019, OpenCensus Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package stackdriver
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path"
+	"strings"
+	"testing"
+	"time"
+
+	"contrib.go.opencensus.io/exporter/stackdriver/monitoredresource"
+	"github.com/google/go-cmp/cmp"
+	"go.opencensus.io/stats/view"
+	monitoredrespb "google.golang.org/genproto/googleapis/api/monitoredres"
+)
+
+func TestResourceValidator(t *testing.T) {
+	var errs []error
+	onError := func(err error) { errs = append(errs, err) }
+	incomplete := &monitoredrespb.MonitoredResource{
+		Type: "k8s_container",
+		Labels: map[string]string{
+			"project_id":     "proj1",
+			"cluster_name":   "cluster1",
+			"namespace_name": "namespace1",
+			"pod_name":       "pod1",
+			"container_name": "",
+		},
+	}
+
+	v := newResourceValidator(Options{OnError: onError, Location: "us-central1-a"})
+	got := v.validate(incomplete)
+	want := &monitoredrespb.MonitoredResource{
+		Type: "generic_task",
+		Labels: map[string]string{
+			"project_id": "proj1",
+			"location":   "us-central1-a",
+			"namespace":  "default",
+			"job":        path.Base(os.Args[0]),
+			"task_id":    getTaskValue(),
+		},
+	}
+	if diff := cmp.Diff(got, want); diff != "" {
+		t.Errorf("validate() returned diff (-got +want):\n%s", diff)
+	}
+	if len(errs) != 1 {
+		t.Fatalf("got %d errors; want 1", len(errs))
+	}
+	if msg := errs[0].Error(); !strings.Contains(msg, "k8s_container") || !strings.Contains(msg, "location, container_name") {
+		t.Errorf("error %q does not name the resource type and missing labels", msg)
+	}
+
+	// The same resource is replaced again without another error.
+	if again := v.validate(incomplete); again != got || len(errs) != 1 {
+		t.Errorf("second validate() = %v with %d errors; want the same replacement and 1 error", again, len(errs))
+	}
+
+	v = newResourceValidator(Options{OnError: onError})
+	if got := v.validate(incomplete); got.Type != "global" || got.Labels["project_id"] != "proj1" {
+		t.Errorf("validate() without location = %v; want global in project proj1", got)
+	}
+
+	for _, mr := range []*monitoredrespb.MonitoredResource{
+		{Type: "global"},
+		{Type: "gce_instance", Labels: map[string]string{"instance_id": "inst1", "zone": "zone1"}},
+		{Type: "custom_type", Labels: map[string]string{}},
+	} {
+		if got := v.validate(mr); got != mr {
+			t.Errorf("validate(%v) = %v; want it unchanged", mr, got)
+		}
+	}
+	if len(errs) != 2 {
+		t.Errorf("got %d errors; want 2", len(errs))
+	}
+}
+
+func TestResourceValidatorBounded(t *testing.T) {
+	var errs []error
+	v := newResourceValidator(Options{Location: "us-central1-a", OnError: func(err error) { errs = append(errs, err) }})
+	for i := 0; i < 2*maxInvalidResources; i++ {
+		pod := fmt.Sprintf("pod-%d", i)
+		v.validate(&monitoredrespb.MonitoredResource{Type: "k8s_container", Labels: map[string]string{"pod_name": pod}})
+		v.validate(&monitoredrespb.MonitoredResource{Type: "generic_node", Labels: map[string]string{"location": "global", "namespace": "default", "node_id": pod}})
+	}
+	if n := len(v.replaced); n > maxInvalidResources {
+		t.Errorf("validator remembers %d resources; want at most %d", n, maxInvalidResources)
+	}
+	if len(errs) != 2*maxInvalidResources {
+		t.Errorf("got %d errors; want %d", len(errs), 2*maxInvalidResources)
+	}
+}
+
+func TestResourceValidatorReentrantOnError(t *testing.T) {
+	var v *resourceValidator
+	incomplete := &monitoredrespb.MonitoredResource{Type: "k8s_container", Labels: map[string]string{"pod_name": "pod1"}}
+	done := make(chan struct{})
+	v = newResourceValidator(Options{OnError: func(error) {
+		// Validating from the error handler must not deadlock.
+		v.validate(incomplete)
+	}})
+	go func() {
+		v.validate(incomplete)
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("validate() deadlocked when OnError validated a resource")
+	}
+}
+
+func TestGetMonitoredResourceValidated(t *testing.T) {
+	var errs []error
+	o := Options{
+		ProjectID: "proj1",
+		Resource:  &monitoredrespb.MonitoredResource{Type: "gce_instance", Labels: map[string]string{"instance_id": "inst1"}},
+		OnError:   func(err error) { errs = append(errs, err) },
+	}
+	e := &statsExporter{o: o, resources: newResourceValidator(o)}
+
+	for i := 0; i < 2; i++ {
+		_, got := e.getMonitoredResource(&view.View{Name: "v"}, nil)
+		if got.Type != "global" {
+			t.Errorf("getMonitoredResource() = %v; want global", got)
+		}
+	}
+	if len(errs) != 1 {
+		t.Errorf("got %d errors; want 1", len(errs))
+	}
+}
+
+func TestGenericNodeFallbackValid(t *testing.T) {
+	var errs []error
+	v := newResourceValidator(Options{ProjectID: "proj1", OnError: func(err error) { errs = append(errs, err) }})
+
+	// With every provider disabled, detection falls back to generic_node.
+	mr := convertMonitoredResourceToPB(monitoredresource.Detect(context.Background(), monitoredresource.DetectOptions{
+		Disabled: map[monitoredresource.Provider]bool{
+			monitoredresource.GCP:   true,
+			monitoredresource.ECS:   true,
+			monitoredresource.AWS:   true,
+			monitoredresource.Azure: true,
+		},
+	}))
+	if mr.Type != "generic_node" {
+		t.Fatalf("Detect() = %v; want generic_node", mr)
+	}
+	if got := v.validate(mr); got != mr || len(errs) != 0 {
+		t.Errorf("validate(%v) = %v with errors %v; want it unchanged", mr, got, errs)
+	}
+}
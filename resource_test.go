@@ -15,7 +15,9 @@
 package stackdriver // import "contrib.go.opencensus.io/exporter/stackdriver"
 
 import (
+	"context"
 	"fmt"
+	"os"
 	"testing"
 
 	"github.com/google/go-cmp/cmp"
@@ -158,6 +160,100 @@ func TestDefaultMapResource(t *testing.T) {
 				},
 			},
 		},
+		// Cloud Run takes precedence over the GCP cloud provider.
+		{
+			input: &resource.Resource{
+				Type: resourcekeys.CloudType,
+				Labels: map[string]string{
+					stackdriverProjectID:             "proj1",
+					resourcekeys.CloudKeyProvider:    resourcekeys.CloudProviderGCP,
+					resourcekeys.CloudKeyRegion:      "region1",
+					resourcekeys.HostKeyID:           "inst1",
+					stackdriverCloudRunService:       "service1",
+					stackdriverCloudRunRevision:      "revision1",
+					stackdriverCloudRunConfiguration: "configuration1",
+				},
+			},
+			want: &monitoredrespb.MonitoredResource{
+				Type: "cloud_run_revision",
+				Labels: map[string]string{
+					"project_id":         "proj1",
+					"location":           "region1",
+					"service_name":       "service1",
+					"revision_name":      "revision1",
+					"configuration_name": "configuration1",
+				},
+			},
+		},
+		{
+			input: &resource.Resource{
+				Type: resourcekeys.CloudType,
+				Labels: map[string]string{
+					stackdriverProjectID:          "proj1",
+					resourcekeys.CloudKeyProvider: resourcekeys.CloudProviderGCP,
+					resourcekeys.CloudKeyZone:     "zone1",
+					stackdriverGAEModuleID:        "module1",
+					stackdriverGAEVersionID:       "version1",
+					stackdriverGAEInstanceID:      "inst1",
+				},
+			},
+			want: &monitoredrespb.MonitoredResource{
+				Type: "gae_instance",
+				Labels: map[string]string{
+					"project_id":  "proj1",
+					"location":    "zone1",
+					"module_id":   "module1",
+					"version_id":  "version1",
+					"instance_id": "inst1",
+				},
+			},
+		},
+		{
+			input: &resource.Resource{
+				Type: resourcekeys.CloudType,
+				Labels: map[string]string{
+					stackdriverProjectID:          "proj1",
+					resourcekeys.CloudKeyProvider: resourcekeys.CloudProviderGCP,
+					resourcekeys.CloudKeyRegion:   "region1",
+					stackdriverCloudFunctionName:  "function1",
+					stackdriverCloudRunService:    "function1",
+				},
+			},
+			want: &monitoredrespb.MonitoredResource{
+				Type: "cloud_function",
+				Labels: map[string]string{
+					"project_id":    "proj1",
+					"region":        "region1",
+					"function_name": "function1",
+				},
+			},
+		},
+		// Kubernetes on AWS.
+		{
+			input: &resource.Resource{
+				Type: resourcekeys.ContainerType,
+				Labels: map[string]string{
+					stackdriverProjectID:             "proj1",
+					resourcekeys.CloudKeyProvider:    resourcekeys.CloudProviderAWS,
+					resourcekeys.CloudKeyRegion:      "region1",
+					resourcekeys.K8SKeyClusterName:   "cluster1",
+					resourcekeys.K8SKeyPodName:       "pod1",
+					resourcekeys.K8SKeyNamespaceName: "namespace1",
+					resourcekeys.ContainerKeyName:    "container-name1",
+				},
+			},
+			want: &monitoredrespb.MonitoredResource{
+				Type: "k8s_container",
+				Labels: map[string]string{
+					"project_id":     "proj1",
+					"location":       "aws:region1",
+					"cluster_name":   "cluster1",
+					"namespace_name": "namespace1",
+					"pod_name":       "pod1",
+					"container_name": "container-name1",
+				},
+			},
+		},
 		// Partial Match
 		{
 			input: &resource.Resource{
@@ -228,3 +324,284 @@ func TestDefaultMapResource(t *testing.T) {
 		})
 	}
 }
+
+func TestResourceMappings(t *testing.T) {
+	const (
+		tenantKey = "example.com/tenant"
+		shardKey  = "example.com/shard"
+	)
+	r := NewResourceMappings(
+		ResourceMapping{
+			Type:           "gce_instance",
+			Match:          cloudProviderIs(resourcekeys.CloudProviderGCP),
+			OptionalLabels: gcpResourceMap,
+			Priority:       100,
+		},
+		ResourceMapping{
+			Type:           "generic_task",
+			RequiredLabels: map[string]string{"namespace": tenantKey},
+			OptionalLabels: map[string]string{"task_id": shardKey},
+			Transforms: map[string]func(string, *resource.Resource) string{
+				"location": func(string, *resource.Resource) string { return "global" },
+				"task_id": func(v string, _ *resource.Resource) string {
+					if v == "" {
+						return ""
+					}
+					return "shard-" + v
+				},
+			},
+			Priority: 200,
+		},
+	)
+	// Registered later with the same priority, so tried after generic_task.
+	r.Register(ResourceMapping{
+		Type:           "generic_node",
+		RequiredLabels: map[string]string{"namespace": tenantKey, "node_id": resourcekeys.HostKeyID},
+		Priority:       200,
+	})
+
+	cases := []struct {
+		labels map[string]string
+		want   *monitoredrespb.MonitoredResource
+	}{
+		{
+			labels: map[string]string{
+				resourcekeys.CloudKeyProvider: resourcekeys.CloudProviderGCP,
+				resourcekeys.HostKeyID:        "inst1",
+				tenantKey:                     "tenant1",
+				shardKey:                      "1",
+			},
+			want: &monitoredrespb.MonitoredResource{
+				Type: "generic_task",
+				Labels: map[string]string{
+					"namespace": "tenant1",
+					"location":  "global",
+					"task_id":   "shard-1",
+				},
+			},
+		},
+		// Required label missing: falls through to the lower priority mapping.
+		{
+			labels: map[string]string{
+				resourcekeys.CloudKeyProvider: resourcekeys.CloudProviderGCP,
+				resourcekeys.HostKeyID:        "inst1",
+			},
+			want: &monitoredrespb.MonitoredResource{
+				Type:   "gce_instance",
+				Labels: map[string]string{"instance_id": "inst1"},
+			},
+		},
+		// No mapping applies.
+		{
+			labels: map[string]string{stackdriverProjectID: "proj1"},
+			want: &monitoredrespb.MonitoredResource{
+				Type:   "global",
+				Labels: map[string]string{"project_id": "proj1"},
+			},
+		},
+	}
+	for i, c := range cases {
+		got := r.MapResource(&resource.Resource{Labels: c.labels})
+		if diff := cmp.Diff(got, c.want); diff != "" {
+			t.Errorf("case %d: MapResource() returned diff (-got +want):\n%s", i, diff)
+		}
+	}
+}
+
+func TestRegisterDefaultResourceMapping(t *testing.T) {
+	old := DefaultResourceMappings
+	DefaultResourceMappings = NewResourceMappings()
+	for _, m := range old.mappings {
+		DefaultResourceMappings.Register(*m)
+	}
+	defer func() { DefaultResourceMappings = old }()
+
+	DefaultResourceMappings.Register(ResourceMapping{
+		Type:           "dataflow_job",
+		RequiredLabels: map[string]string{"job_name": "dataflow.job.name"},
+		OptionalLabels: map[string]string{"project_id": stackdriverProjectID, "region": resourcekeys.CloudKeyRegion},
+		Priority:       1000,
+	})
+	got := defaultMapResource(&resource.Resource{
+		Type: resourcekeys.CloudType,
+		Labels: map[string]string{
+			stackdriverProjectID:          "proj1",
+			resourcekeys.CloudKeyProvider: resourcekeys.CloudProviderGCP,
+			resourcekeys.CloudKeyRegion:   "region1",
+			"dataflow.job.name":           "job1",
+		},
+	})
+	want := &monitoredrespb.MonitoredResource{
+		Type: "dataflow_job",
+		Labels: map[string]string{
+			"project_id": "proj1",
+			"region":     "region1",
+			"job_name":   "job1",
+		},
+	}
+	if diff := cmp.Diff(got, want); diff != "" {
+		t.Errorf("defaultMapResource() returned diff (-got +want):\n%s", diff)
+	}
+}
+
+// testClientOptions returns o with clients that don't need credentials.
+func testClientOptions(o Options) Options {
+	o.MonitoringClientOptions = authOptions
+	o.TraceClientOptions = authOptions
+	return o
+}
+
+// setEnv sets the environment variables in vars, unsetting those with an
+// empty value, and returns a function that restores their previous values.
+func setEnv(vars map[string]string) func() {
+	old := make(map[string]*string, len(vars))
+	for k, v := range vars {
+		if prev, ok := os.LookupEnv(k); ok {
+			old[k] = &prev
+		} else {
+			old[k] = nil
+		}
+		if v == "" {
+			os.Unsetenv(k)
+		} else {
+			os.Setenv(k, v)
+		}
+	}
+	return func() {
+		for k, v := range old {
+			if v == nil {
+				os.Unsetenv(k)
+			} else {
+				os.Setenv(k, *v)
+			}
+		}
+	}
+}
+
+func TestResourceDetectorPlatformLabels(t *testing.T) {
+	cases := []struct {
+		name string
+		env  map[string]string
+		want *monitoredrespb.MonitoredResource
+	}{
+		{
+			name: "Cloud Run",
+			env: map[string]string{
+				"K_SERVICE":       "service1",
+				"K_REVISION":      "service1-00001",
+				"K_CONFIGURATION": "service1",
+			},
+			want: &monitoredrespb.MonitoredResource{
+				Type: "cloud_run_revision",
+				Labels: map[string]string{
+					"project_id":         "proj1",
+					"location":           "us-central1",
+					"service_name":       "service1",
+					"revision_name":      "service1-00001",
+					"configuration_name": "service1",
+				},
+			},
+		},
+		{
+			name: "App Engine",
+			env: map[string]string{
+				"GAE_SERVICE":  "default",
+				"GAE_VERSION":  "v1",
+				"GAE_INSTANCE": "instance1",
+			},
+			want: &monitoredrespb.MonitoredResource{
+				Type: "gae_instance",
+				Labels: map[string]string{
+					"project_id":  "proj1",
+					"location":    "us-central1-a",
+					"module_id":   "default",
+					"version_id":  "v1",
+					"instance_id": "instance1",
+				},
+			},
+		},
+		{
+			name: "Cloud Functions",
+			env: map[string]string{
+				"FUNCTION_TARGET": "HelloWorld",
+				"K_SERVICE":       "hello",
+			},
+			want: &monitoredrespb.MonitoredResource{
+				Type: "cloud_function",
+				Labels: map[string]string{
+					"project_id":    "proj1",
+					"region":        "us-central1",
+					"function_name": "hello",
+				},
+			},
+		},
+		{
+			name: "Cloud Functions with K_SERVICE and FUNCTION_NAME",
+			env: map[string]string{
+				"FUNCTION_TARGET": "HelloWorld",
+				"K_SERVICE":       "hello",
+				"FUNCTION_NAME":   "other",
+			},
+			want: &monitoredrespb.MonitoredResource{
+				Type: "cloud_function",
+				Labels: map[string]string{
+					"project_id":    "proj1",
+					"region":        "us-central1",
+					"function_name": "hello",
+				},
+			},
+		},
+		{
+			name: "Cloud Functions without K_SERVICE",
+			env: map[string]string{
+				"FUNCTION_TARGET": "HelloWorld",
+				"FUNCTION_NAME":   "hello",
+			},
+			want: &monitoredrespb.MonitoredResource{
+				Type: "cloud_function",
+				Labels: map[string]string{
+					"project_id":    "proj1",
+					"region":        "us-central1",
+					"function_name": "hello",
+				},
+			},
+		},
+	}
+	for _, c := range cases {
+		env := map[string]string{
+			"K_SERVICE":       "",
+			"K_REVISION":      "",
+			"K_CONFIGURATION": "",
+			"GAE_SERVICE":     "",
+			"GAE_VERSION":     "",
+			"GAE_INSTANCE":    "",
+			"FUNCTION_TARGET": "",
+			"FUNCTION_NAME":   "",
+		}
+		for k, v := range c.env {
+			env[k] = v
+		}
+		restore := setEnv(env)
+		e, err := NewExporter(testClientOptions(Options{
+			ProjectID: "proj1",
+			Location:  "us-central1-a",
+			ResourceDetector: func(context.Context) (*resource.Resource, error) {
+				return &resource.Resource{
+					Type: resourcekeys.CloudType,
+					Labels: map[string]string{
+						resourcekeys.CloudKeyProvider: resourcekeys.CloudProviderGCP,
+						resourcekeys.CloudKeyRegion:   "us-central1",
+						resourcekeys.CloudKeyZone:     "us-central1-a",
+					},
+				}, nil
+			},
+		}))
+		restore()
+		if err != nil {
+			t.Fatalf("%s: NewExporter() error = %v", c.name, err)
+		}
+		if diff := cmp.Diff(e.statsExporter.o.Resource, c.want); diff != "" {
+			t.Errorf("%s: resource returned diff (-got +want):\n%s", c.name, diff)
+		}
+	}
+}
@@ -0,0 +1,178 @@
+// Copyright 2019, OpenCensus Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package stackdriver
+
+/*
+The code in this file routes spans and time series to destination projects
+other than Options.ProjectID.
+*/
+
+import (
+	"context"
+	"fmt"
+
+	monitoring "cloud.google.com/go/monitoring/apiv3"
+	"github.com/golang/protobuf/proto"
+	"go.opencensus.io/trace"
+	metricpb "google.golang.org/genproto/googleapis/api/metric"
+	monitoringpb "google.golang.org/genproto/googleapis/monitoring/v3"
+)
+
+// RoutingProjectIDKey is the span attribute and tag key read by
+// DefaultSpanProjectID and DefaultTimeSeriesProjectID.
+const RoutingProjectIDKey = "stackdriver_project_id"
+
+// DefaultSpanProjectID is the default router for Options.GetSpanProjectID.
+// It routes spans to the project named by the RoutingProjectIDKey string
+// attribute. Spans without the attribute are exported to Options.ProjectID.
+//
+// Routing is opt-in: it is not applied when GetSpanProjectID is nil, so that
+// attributes set by instrumentation never move spans to other projects
+// unless the application asks for it.
+func DefaultSpanProjectID(s *trace.SpanData) string {
+	projectID, _ := s.Attributes[RoutingProjectIDKey].(string)
+	return projectID
+}
+
+// DefaultTimeSeriesProjectID is the default router for
+// Options.GetTimeSeriesProjectID. It routes time series to the project named
+// by the RoutingProjectIDKey tag or metric label. Time series without the
+// label are exported to Options.ProjectID.
+//
+// Routing is opt-in: it is not applied when GetTimeSeriesProjectID is nil,
+// which also spares uploads the per-project metric descriptor checks.
+func DefaultTimeSeriesProjectID(ts *monitoringpb.TimeSeries) string {
+	return ts.GetMetric().GetLabels()[RoutingProjectIDKey]
+}
+
+// ProjectIDFromSpanAttribute returns a function for Options.GetSpanProjectID
+// that routes spans to the project named by the string attribute key.
+// Spans without the attribute are exported to Options.ProjectID.
+func ProjectIDFromSpanAttribute(key string) func(*trace.SpanData) string {
+	return func(s *trace.SpanData) string {
+		projectID, _ := s.Attributes[key].(string)
+		return projectID
+	}
+}
+
+// ProjectIDFromMetricLabel returns a function for
+// Options.GetTimeSeriesProjectID that routes time series to the project
+// named by the tag or metric label key. Time series without the label are
+// exported to Options.ProjectID.
+func ProjectIDFromMetricLabel(key string) func(*monitoringpb.TimeSeries) string {
+	key = sanitize(key)
+	return func(ts *monitoringpb.TimeSeries) string {
+		return ts.GetMetric().GetLabels()[key]
+	}
+}
+
+// spanProjectID returns the project s is exported to.
+func (e *traceExporter) spanProjectID(s *trace.SpanData) string {
+	if e.o.GetSpanProjectID != nil {
+		if projectID := e.o.GetSpanProjectID(s); projectID != "" {
+			return projectID
+		}
+	}
+	return e.projectID
+}
+
+// timeSeriesProjectID returns the project ts is exported to.
+func (se *statsExporter) timeSeriesProjectID(ts *monitoringpb.TimeSeries) string {
+	if se.o.GetTimeSeriesProjectID != nil {
+		if projectID := se.o.GetTimeSeriesProjectID(ts); projectID != "" {
+			return projectID
+		}
+	}
+	return se.o.ProjectID
+}
+
+// groupTimeSeriesByProject splits ts by destination project. Projects are
+// returned in the order they are first seen.
+func (se *statsExporter) groupTimeSeriesByProject(ts []*monitoringpb.TimeSeries) (projects []string, groups map[string][]*monitoringpb.TimeSeries) {
+	groups = make(map[string][]*monitoringpb.TimeSeries)
+	for _, t := range ts {
+		projectID := se.timeSeriesProjectID(t)
+		if _, ok := groups[projectID]; !ok {
+			projects = append(projects, projectID)
+		}
+		groups[projectID] = append(groups[projectID], t)
+	}
+	return projects, groups
+}
+
+// timeSeriesRequestsByProject returns one CreateTimeSeriesRequest per
+// destination project of ts, without de-duping.
+func (se *statsExporter) timeSeriesRequestsByProject(ts []*monitoringpb.TimeSeries) []*monitoringpb.CreateTimeSeriesRequest {
+	if se.o.GetTimeSeriesProjectID == nil {
+		return []*monitoringpb.CreateTimeSeriesRequest{{
+			Name:       monitoring.MetricProjectPath(se.o.ProjectID),
+			TimeSeries: ts,
+		}}
+	}
+	var reqs []*monitoringpb.CreateTimeSeriesRequest
+	projects, groups := se.groupTimeSeriesByProject(ts)
+	for _, projectID := range projects {
+		reqs = append(reqs, &monitoringpb.CreateTimeSeriesRequest{
+			Name:       monitoring.MetricProjectPath(projectID),
+			TimeSeries: groups[projectID],
+		})
+	}
+	return reqs
+}
+
+// createRoutedMetricDescriptors creates the metric descriptors of the time
+// series in reqs that are routed away from Options.ProjectID in their
+// destination projects. mds holds the descriptors by metric type. The
+// descriptors of Options.ProjectID are created and cached by the callers.
+func (se *statsExporter) createRoutedMetricDescriptors(ctx context.Context, reqs []*monitoringpb.CreateTimeSeriesRequest, mds map[string]*metricpb.MetricDescriptor) error {
+	defaultProject := monitoring.MetricProjectPath(se.o.ProjectID)
+
+	se.routedMu.Lock()
+	defer se.routedMu.Unlock()
+
+	for _, req := range reqs {
+		if req.Name == defaultProject {
+			continue
+		}
+		for _, ts := range req.TimeSeries {
+			metricType := ts.GetMetric().GetType()
+			name := fmt.Sprintf("%s/metricDescriptors/%s", req.Name, metricType)
+			if _, created := se.routedMetricDescriptors[name]; created {
+				continue
+			}
+			md, ok := mds[metricType]
+			if !ok {
+				continue
+			}
+			// Built-in metric descriptors exist in every project.
+			if !builtinMetric(metricType) {
+				routed := proto.Clone(md).(*metricpb.MetricDescriptor)
+				routed.Name = name
+				cmrdesc := &monitoringpb.CreateMetricDescriptorRequest{
+					Name:             req.Name,
+					MetricDescriptor: routed,
+				}
+				if _, err := createMetricDescriptor(ctx, se.c, cmrdesc); err != nil {
+					return err
+				}
+			}
+			if se.routedMetricDescriptors == nil {
+				se.routedMetricDescriptors = make(map[string]struct{})
+			}
+			se.routedMetricDescriptors[name] = struct{}{}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,148 @@
+// Copyright 2019, OpenCensus Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package stackdriver
+
+import (
+	"context"
+	"testing"
+
+	monitoring "cloud.google.com/go/monitoring/apiv3"
+	"go.opencensus.io/trace"
+	metricpb "google.golang.org/genproto/googleapis/api/metric"
+	tracepb "google.golang.org/genproto/googleapis/devtools/cloudtrace/v2"
+	monitoringpb "google.golang.org/genproto/googleapis/monitoring/v3"
+)
+
+func TestSpanProjectRouting(t *testing.T) {
+	e := newTraceExporterWithClient(Options{
+		ProjectID:            "default",
+		GetSpanProjectID:     ProjectIDFromSpanAttribute("tenant"),
+		BundleCountThreshold: 3,
+	}, nil)
+	var got []*tracepb.Span
+	e.uploadFn = func(spans []*tracepb.Span) {
+		got = append(got, spans...)
+	}
+	for _, sd := range []*trace.SpanData{
+		{Name: "a", Attributes: map[string]interface{}{"tenant": "tenant-a"}},
+		{Name: "b"},
+		{Name: "c", Attributes: map[string]interface{}{"tenant": "tenant-a"}},
+	} {
+		e.ExportSpan(sd)
+	}
+	e.Flush()
+
+	reqs := e.batchWriteSpansRequests(got)
+	if len(reqs) != 2 {
+		t.Fatalf("got %d requests; want 2", len(reqs))
+	}
+	for i, want := range []struct {
+		name  string
+		spans int
+	}{
+		{"projects/tenant-a", 2},
+		{"projects/default", 1},
+	} {
+		if reqs[i].Name != want.name || len(reqs[i].Spans) != want.spans {
+			t.Errorf("request %d = %s with %d spans; want %s with %d spans", i, reqs[i].Name, len(reqs[i].Spans), want.name, want.spans)
+		}
+	}
+}
+
+func TestTimeSeriesProjectRouting(t *testing.T) {
+	oldCreateMetricDescriptor := createMetricDescriptor
+	defer func() {
+		createMetricDescriptor = oldCreateMetricDescriptor
+	}()
+	var created []string
+	createMetricDescriptor = func(ctx context.Context, c *monitoring.MetricClient, mdr *monitoringpb.CreateMetricDescriptorRequest) (*metricpb.MetricDescriptor, error) {
+		created = append(created, mdr.MetricDescriptor.Name)
+		return mdr.MetricDescriptor, nil
+	}
+
+	se := &statsExporter{
+		o: Options{
+			ProjectID:              "default",
+			GetTimeSeriesProjectID: ProjectIDFromMetricLabel("tenant"),
+		},
+	}
+	newTs := func(tenant string) *monitoringpb.TimeSeries {
+		labels := map[string]string{"key": "value"}
+		if tenant != "" {
+			labels["tenant"] = tenant
+		}
+		return &monitoringpb.TimeSeries{
+			Metric: &metricpb.Metric{Type: "custom.googleapis.com/opencensus/count", Labels: labels},
+		}
+	}
+	reqs := se.combineTimeSeriesToCreateTimeSeriesRequest([]*monitoringpb.TimeSeries{
+		newTs(""), newTs("tenant-a"), newTs("tenant-b"), newTs("tenant-a"),
+	})
+	var names []string
+	for _, req := range reqs {
+		names = append(names, req.Name)
+	}
+	wantNames := []string{"projects/default", "projects/tenant-a", "projects/tenant-a", "projects/tenant-b"}
+	if len(names) != len(wantNames) {
+		t.Fatalf("request names = %v; want %v", names, wantNames)
+	}
+	for i := range names {
+		if names[i] != wantNames[i] {
+			t.Fatalf("request names = %v; want %v", names, wantNames)
+		}
+	}
+
+	mds := map[string]*metricpb.MetricDescriptor{
+		"custom.googleapis.com/opencensus/count": {
+			Name: "projects/default/metricDescriptors/custom.googleapis.com/opencensus/count",
+			Type: "custom.googleapis.com/opencensus/count",
+		},
+	}
+	for i := 0; i < 2; i++ {
+		if err := se.createRoutedMetricDescriptors(context.Background(), reqs, mds); err != nil {
+			t.Fatal(err)
+		}
+	}
+	wantCreated := []string{
+		"projects/tenant-a/metricDescriptors/custom.googleapis.com/opencensus/count",
+		"projects/tenant-b/metricDescriptors/custom.googleapis.com/opencensus/count",
+	}
+	if len(created) != len(wantCreated) || created[0] != wantCreated[0] || created[1] != wantCreated[1] {
+		t.Errorf("created descriptors = %v; want %v", created, wantCreated)
+	}
+	if got := mds["custom.googleapis.com/opencensus/count"].Name; got != "projects/default/metricDescriptors/custom.googleapis.com/opencensus/count" {
+		t.Errorf("template descriptor was modified: %q", got)
+	}
+}
+
+func TestDefaultProjectIDRouters(t *testing.T) {
+	s := &trace.SpanData{Attributes: map[string]interface{}{RoutingProjectIDKey: "tenant-a"}}
+	if got := DefaultSpanProjectID(s); got != "tenant-a" {
+		t.Errorf("DefaultSpanProjectID = %q; want tenant-a", got)
+	}
+	if got := DefaultSpanProjectID(&trace.SpanData{}); got != "" {
+		t.Errorf("DefaultSpanProjectID without attribute = %q; want empty", got)
+	}
+
+	ts := &monitoringpb.TimeSeries{
+		Metric: &metricpb.Metric{Labels: map[string]string{RoutingProjectIDKey: "tenant-b"}},
+	}
+	if got := DefaultTimeSeriesProjectID(ts); got != "tenant-b" {
+		t.Errorf("DefaultTimeSeriesProjectID = %q; want tenant-b", got)
+	}
+	if got := DefaultTimeSeriesProjectID(&monitoringpb.TimeSeries{}); got != "" {
+		t.Errorf("DefaultTimeSeriesProjectID without label = %q; want empty", got)
+	}
+}
@@ -0,0 +1,122 @@
+// Copyright 2019, OpenCensus Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package stackdriver
+
+/*
+The code in this file derives request count, error count and latency
+metrics from the spans seen by the exporter.
+*/
+
+import (
+	"context"
+
+	"go.opencensus.io/stats"
+	"go.opencensus.io/stats/view"
+	"go.opencensus.io/tag"
+	"go.opencensus.io/trace"
+	codepb "google.golang.org/genproto/googleapis/rpc/code"
+)
+
+var (
+	spanLatencyMeasure = stats.Float64("trace/span_latency", "Latency of exported spans", stats.UnitMilliseconds)
+	spanErrorMeasure   = stats.Int64("trace/span_errors", "Number of exported spans with a non-OK status", stats.UnitDimensionless)
+)
+
+// Tag keys attached to the span metrics.
+var (
+	KeySpanName   = tag.MustNewKey("span_name")
+	KeySpanKind   = tag.MustNewKey("span_kind")
+	KeySpanStatus = tag.MustNewKey("span_status")
+)
+
+var spanMetricsTagKeys = []tag.Key{KeySpanName, KeySpanKind, KeySpanStatus}
+
+// Views derived from exported spans when Options.EnableSpanMetrics is set.
+var (
+	SpanCountView = &view.View{
+		Name:        "trace/span_count",
+		Description: "Count of exported spans, by name, kind and status",
+		Measure:     spanLatencyMeasure,
+		TagKeys:     spanMetricsTagKeys,
+		Aggregation: view.Count(),
+	}
+
+	SpanErrorCountView = &view.View{
+		Name:        "trace/span_error_count",
+		Description: "Count of exported spans with a non-OK status, by name and kind",
+		Measure:     spanErrorMeasure,
+		TagKeys:     []tag.Key{KeySpanName, KeySpanKind},
+		Aggregation: view.Count(),
+	}
+
+	SpanLatencyView = &view.View{
+		Name:        "trace/span_latency",
+		Description: "Latency distribution of exported spans, by name, kind and status",
+		Measure:     spanLatencyMeasure,
+		TagKeys:     spanMetricsTagKeys,
+		Aggregation: view.Distribution(0, 1, 2, 3, 4, 5, 6, 8, 10, 13, 16, 20, 25, 30, 40, 50, 65, 80, 100, 130, 160, 200, 250, 300, 400, 500, 650, 800, 1000, 2000, 5000, 10000, 20000, 50000, 100000),
+	}
+
+	// SpanMetricsViews are the views registered by NewExporter when
+	// Options.EnableSpanMetrics is set.
+	SpanMetricsViews = []*view.View{
+		SpanCountView,
+		SpanErrorCountView,
+		SpanLatencyView,
+	}
+)
+
+// spanKindName returns the value of the span_kind tag for a span kind.
+func spanKindName(kind int) string {
+	switch kind {
+	case trace.SpanKindServer:
+		return "server"
+	case trace.SpanKindClient:
+		return "client"
+	default:
+		return "unspecified"
+	}
+}
+
+// recordSpanMetrics records the request count, error count and latency of
+// sd to the measures of SpanMetricsViews.
+func recordSpanMetrics(sd *trace.SpanData) {
+	ms := []stats.Measurement{
+		spanLatencyMeasure.M(float64(sd.EndTime.Sub(sd.StartTime)) / 1e6),
+	}
+	if sd.Status.Code != trace.StatusCodeOK {
+		ms = append(ms, spanErrorMeasure.M(1))
+	}
+	stats.RecordWithTags(context.Background(), []tag.Mutator{
+		tag.Upsert(KeySpanName, sd.Name),
+		tag.Upsert(KeySpanKind, spanKindName(sd.SpanKind)),
+		tag.Upsert(KeySpanStatus, codepb.Code(sd.Status.Code).String()),
+	}, ms...)
+}
+
+// traceSampled reports whether sd is uploaded under Options.TraceSampler.
+// The parent context is left out so that the decision depends on the trace
+// only, as the spans were all sampled by the application.
+func (o Options) traceSampled(sd *trace.SpanData) bool {
+	if o.TraceSampler == nil {
+		return true
+	}
+	return o.TraceSampler(trace.SamplingParameters{
+		TraceID:         sd.TraceID,
+		SpanID:          sd.SpanID,
+		Name:            sd.Name,
+		HasRemoteParent: sd.HasRemoteParent,
+	}).Sample
+}
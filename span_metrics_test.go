@@ -0,0 +1,128 @@
+// Copyright 2019, OpenCensus Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package stackdriver
+
+import (
+	"testing"
+	"time"
+
+	"go.opencensus.io/stats/view"
+	"go.opencensus.io/tag"
+	"go.opencensus.io/trace"
+	tracepb "google.golang.org/genproto/googleapis/devtools/cloudtrace/v2"
+)
+
+func TestSpanMetrics(t *testing.T) {
+	if err := view.Register(SpanMetricsViews...); err != nil {
+		t.Fatal(err)
+	}
+	defer view.Unregister(SpanMetricsViews...)
+
+	te := newTraceExporterWithClient(Options{EnableSpanMetrics: true}, nil)
+	te.uploadFn = func(spans []*tracepb.Span) {}
+	e := &Exporter{traceExporter: te}
+
+	start := time.Now()
+	for _, sd := range []*trace.SpanData{
+		{Name: "/get", SpanKind: trace.SpanKindServer, StartTime: start, EndTime: start.Add(10 * time.Millisecond)},
+		{Name: "/get", SpanKind: trace.SpanKindServer, StartTime: start, EndTime: start.Add(30 * time.Millisecond)},
+		{Name: "/get", SpanKind: trace.SpanKindServer, StartTime: start, EndTime: start.Add(time.Millisecond), Status: trace.Status{Code: trace.StatusCodeUnavailable}},
+	} {
+		e.ExportSpan(sd)
+	}
+
+	rows, err := view.RetrieveData(SpanCountView.Name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	counts := make(map[string]int64)
+	for _, row := range rows {
+		status, _ := findTag(row.Tags, KeySpanStatus.Name())
+		kind, _ := findTag(row.Tags, KeySpanKind.Name())
+		if kind != "server" {
+			t.Errorf("span_kind = %q; want server", kind)
+		}
+		counts[status] = row.Data.(*view.CountData).Value
+	}
+	if counts["OK"] != 2 || counts["UNAVAILABLE"] != 1 {
+		t.Errorf("span counts = %v; want 2 OK and 1 UNAVAILABLE", counts)
+	}
+
+	rows, err = view.RetrieveData(SpanErrorCountView.Name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rows) != 1 || rows[0].Data.(*view.CountData).Value != 1 {
+		t.Errorf("error count rows = %v; want a single row with count 1", rows)
+	} else if _, ok := findTag(rows[0].Tags, KeySpanStatus.Name()); ok {
+		t.Errorf("error count rows are tagged with span_status: %v", rows)
+	}
+
+	rows, err = view.RetrieveData(SpanLatencyView.Name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, row := range rows {
+		if status, _ := findTag(row.Tags, KeySpanStatus.Name()); status != "OK" {
+			continue
+		}
+		if mean := row.Data.(*view.DistributionData).Mean; mean != 20 {
+			t.Errorf("mean latency = %v; want 20", mean)
+		}
+	}
+}
+
+func TestSpanMetricsTraceSampler(t *testing.T) {
+	if err := view.Register(SpanMetricsViews...); err != nil {
+		t.Fatal(err)
+	}
+	defer view.Unregister(SpanMetricsViews...)
+
+	keep := trace.TraceID{1}
+	te := newTraceExporterWithClient(Options{
+		EnableSpanMetrics: true,
+		TraceSampler: func(p trace.SamplingParameters) trace.SamplingDecision {
+			return trace.SamplingDecision{Sample: p.TraceID == keep}
+		},
+	}, nil)
+	var uploaded int
+	te.uploadFn = func(spans []*tracepb.Span) { uploaded += len(spans) }
+	e := &Exporter{traceExporter: te}
+
+	start := time.Now()
+	e.ExportSpan(&trace.SpanData{SpanContext: trace.SpanContext{TraceID: keep}, Name: "/get", StartTime: start, EndTime: start})
+	e.ExportSpan(&trace.SpanData{SpanContext: trace.SpanContext{TraceID: trace.TraceID{2}}, Name: "/get", StartTime: start, EndTime: start})
+	te.Flush()
+
+	rows, err := view.RetrieveData(SpanCountView.Name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rows) != 1 || rows[0].Data.(*view.CountData).Value != 2 {
+		t.Errorf("span count rows = %v; want a single row with count 2", rows)
+	}
+	if uploaded != 1 {
+		t.Errorf("uploaded %d spans; want 1", uploaded)
+	}
+}
+
+func findTag(tags []tag.Tag, name string) (string, bool) {
+	for _, t := range tags {
+		if t.Key.Name() == name {
+			return t.Value, true
+		}
+	}
+	return "", false
+}
@@ -66,6 +66,7 @@ import (
 	"golang.org/x/oauth2/google"
 	"google.golang.org/api/option"
 	monitoredrespb "google.golang.org/genproto/googleapis/api/monitoredres"
+	monitoringpb "google.golang.org/genproto/googleapis/monitoring/v3"
 
 	commonpb "github.com/census-instrumentation/opencensus-proto/gen-go/agent/common/v1"
 	metricspb "github.com/census-instrumentation/opencensus-proto/gen-go/metrics/v1"
@@ -127,6 +128,14 @@ type Options struct {
 	// If unset, a default of 8MB will be used.
 	TraceSpansBufferMaxBytes int
 
+	// TraceSpansMaxRequestBytes is the maximum size (in bytes) of a request
+	// uploading spans to Stackdriver Trace. Spans are batched up to this
+	// size, and larger spans are trimmed to fit by dropping their stack
+	// trace, annotations, links and attributes.
+	//
+	// If unset, a default of 4MB will be used.
+	TraceSpansMaxRequestBytes int
+
 	// Resource sets the MonitoredResource against which all views will be
 	// recorded by this exporter.
 	//
@@ -182,8 +191,9 @@ type Options struct {
 
 	// MapResource converts a OpenCensus resource to a Stackdriver monitored resource.
 	//
-	// If this field is unset, defaultMapResource will be used which encodes a set of default
+	// If this field is unset, DefaultResourceMappings.MapResource will be used which encodes a set of default
 	// conversions from auto-detected resources to well-known Stackdriver monitored resources.
+	// Register a ResourceMapping with DefaultResourceMappings to support other resources.
 	MapResource func(*resource.Resource) *monitoredrespb.MonitoredResource
 
 	// MetricPrefix overrides the prefix of a Stackdriver metric display names.
@@ -209,6 +219,120 @@ type Options struct {
 	// Stackdriver Trace.
 	DefaultTraceAttributes map[string]interface{}
 
+	// AttributeRules rename, drop or hash span, annotation and link attributes
+	// before they are exported to Stackdriver Trace. When several rules share
+	// a key, the last one wins, so presets can be combined with custom rules:
+	//   append(append([]AttributeRule{}, OCHTTPAttributeRules...), myRules...)
+	//
+	// If unset, OCHTTPAttributeRules is used. Set this to an empty non-nil
+	// slice to export attribute keys unchanged.
+	// Optional.
+	AttributeRules []AttributeRule
+
+	// JSONEncodeCompositeAttributes exports span attribute values of types
+	// that Stackdriver Trace cannot represent, such as slices other than
+	// []string, maps and structs, as JSON encoded strings truncated to the attribute value
+	// limit. If unset, such attributes are dropped and counted in the
+	// dropped attributes count of the span.
+	// Optional.
+	JSONEncodeCompositeAttributes bool
+
+	// SpanLimits caps the number of attributes and links exported per span.
+	// If unset, the Stackdriver Trace limits are used.
+	// Optional.
+	SpanLimits SpanLimits
+
+	// RedactionRules scrub sensitive data such as emails or tokens from span
+	// attributes, annotations and status messages before spans are converted
+	// and uploaded to Stackdriver Trace. DefaultRedactionRules contains the
+	// built-in detectors.
+	// Optional.
+	RedactionRules []RedactionRule
+
+	// OnRedaction is called for every span that had data scrubbed by
+	// RedactionRules, with the number of values redacted per rule.
+	// Optional.
+	OnRedaction func(RedactionReport)
+
+	// SpanNaming controls the display names of spans exported to Stackdriver
+	// Trace: the kind prefixes, attribute based name templates and
+	// normalization of high-cardinality names.
+	// Optional.
+	SpanNaming SpanNamingPolicy
+
+	// CaptureStackTraces attaches the stack trace of the goroutine ending a
+	// span to spans that end with a non-OK status. Repeated stack traces
+	// within a trace are only sent once and referenced by hash afterwards.
+	//
+	// The stack trace is captured when the span is exported, which
+	// OpenCensus does in Span.End. It shows where the span was ended, not
+	// where the error occurred or the status was set; spans passed to
+	// ExportSpan by other code get the stack of that caller.
+	// Optional.
+	CaptureStackTraces bool
+
+	// StackTraceAttribute, if set, also attaches a stack trace to every span
+	// carrying an attribute with this key, regardless of CaptureStackTraces.
+	// The stack trace is captured when the span is ended, as described for
+	// CaptureStackTraces.
+	// Optional.
+	StackTraceAttribute string
+
+	// EnableSpanMetrics derives request count, error count and latency
+	// metrics from every span passed to Exporter.ExportSpan. NewExporter
+	// registers SpanMetricsViews, so the metrics are exported like any other
+	// view, grouped by span name, kind and status.
+	//
+	// OpenCensus only passes sampled spans to exporters, so unsampled spans
+	// are not counted. To count every span while uploading only a sample,
+	// sample every span with trace.AlwaysSample and set TraceSampler.
+	// Optional.
+	EnableSpanMetrics bool
+
+	// TraceSampler, if set, selects the spans uploaded to Stackdriver Trace
+	// after the span metrics have been recorded, e.g.
+	// trace.ProbabilitySampler(0.01). It is called with the trace ID, span
+	// ID and name of each span and no parent context, so probability
+	// samplers keep or drop whole traces.
+	// Optional. By default every span passed to ExportSpan is uploaded.
+	TraceSampler trace.Sampler
+
+	// ErrorReporting, if set, also reports every exported span that ends
+	// with a non-OK status to Cloud Error Reporting, with the status message,
+	// the stack trace of the goroutine ending the span and a link to the
+	// trace. Reports are rate limited.
+	// Optional.
+	ErrorReporting *ErrorReportingOptions
+
+	// SpanFilters drop the spans matching any of the filters before they are
+	// converted and uploaded to Stackdriver Trace, e.g. HealthCheckSpanFilter.
+	// Dropped spans are still counted by the span metrics. The number of
+	// spans dropped per filter is reported by Exporter.FilteredSpanCounts.
+	// Optional.
+	SpanFilters []SpanFilter
+
+	// GetSpanProjectID routes each span to the returned project instead of
+	// ProjectID, e.g. for services handling requests on behalf of several
+	// projects. An empty return value selects ProjectID.
+	// DefaultSpanProjectID routes by the RoutingProjectIDKey attribute and
+	// ProjectIDFromSpanAttribute reads the project from any span attribute.
+	// Optional.
+	GetSpanProjectID func(*trace.SpanData) string
+
+	// SpanResource selects the monitored resource labels attached to spans
+	// as attributes, and the resource of each span.
+	// Optional. By default all labels of the exporter's resource are attached.
+	SpanResource SpanResourceOptions
+
+	// GetTimeSeriesProjectID routes each time series to the returned project
+	// instead of ProjectID. An empty return value selects ProjectID. Metric
+	// descriptors are created in every project that receives time series.
+	// DefaultTimeSeriesProjectID routes by the RoutingProjectIDKey tag and
+	// ProjectIDFromMetricLabel reads the project from any tag or metric
+	// label.
+	// Optional.
+	GetTimeSeriesProjectID func(*monitoringpb.TimeSeries) string
+
 	// DefaultMonitoringLabels are labels added to every metric created by this
 	// exporter in Stackdriver Monitoring.
 	//
@@ -256,9 +380,29 @@ type Options struct {
 	// value.
 	GetMonitoredResource func(*view.View, []tag.Tag) ([]tag.Tag, monitoredresource.Interface)
 
+	// GetMetricResource may be provided to select the monitored resource of
+	// each time series, for views as well as for metrics exported with
+	// ExportMetrics, ExportMetricsProto or the metrics reader. It receives
+	// the metric descriptor, the labels and the OpenCensus resource of the
+	// time series and returns the labels to write and the monitored
+	// resource. Labels may be moved to the resource, for instance a "pod"
+	// tag to the pod_name label of a k8s_container resource, by leaving them
+	// out of the returned labels. A nil resource keeps the resource the
+	// exporter would otherwise use, with the returned labels.
+	//
+	// GetMonitoredResource is ignored if this field is set. The returned
+	// resources are checked against RequiredResourceLabels.
+	//
+	// Optional.
+	GetMetricResource func(MetricResourceInput) (map[string]string, *monitoredrespb.MonitoredResource)
+
 	// ReportingInterval sets the interval between reporting metrics.
 	// If it is set to zero then default value is used.
 	ReportingInterval time.Duration
+
+	// detectedResource is the resource returned by ResourceDetector, passed
+	// to GetMetricResource for views.
+	detectedResource *resource.Resource
 }
 
 const defaultTimeout = 5 * time.Second
@@ -271,11 +415,18 @@ const defaultTimeout = 5 * time.Second
 type Exporter struct {
 	traceExporter *traceExporter
 	statsExporter *statsExporter
+
+	// onError dispatches errors to the current OnError hook; see Update.
+	onError *errorHandler
 }
 
 // NewExporter creates a new Exporter that implements both stats.Exporter and
-// trace.Exporter.
+// trace.Exporter. It fails if Options.Validate reports errors, and reports
+// validation warnings through OnError.
 func NewExporter(o Options) (*Exporter, error) {
+	if err := o.validateExporter(o.EnableSpanMetrics); err != nil {
+		return nil, err
+	}
 	if o.ProjectID == "" {
 		ctx := o.Context
 		if ctx == nil {
@@ -318,10 +469,6 @@ func NewExporter(o Options) (*Exporter, error) {
 		o.MapResource = defaultMapResource
 	}
 	if o.ResourceDetector != nil {
-		// For backwards-compatibility we still respect the deprecated resource field.
-		if o.Resource != nil {
-			return nil, errors.New("stackdriver: ResourceDetector must not be used in combination with deprecated resource fields")
-		}
 		res, err := o.ResourceDetector(o.Context)
 		if err != nil {
 			return nil, fmt.Errorf("stackdriver: detect resource: %s", err)
@@ -333,14 +480,26 @@ func NewExporter(o Options) (*Exporter, error) {
 		res.Labels[stackdriverGenericTaskNamespace] = "default"
 		res.Labels[stackdriverGenericTaskJob] = path.Base(os.Args[0])
 		res.Labels[stackdriverGenericTaskID] = getTaskValue()
+		setServerlessResourceLabels(res.Labels)
 
 		o.Resource = o.MapResource(res)
+		o.detectedResource = res
 	}
 
+	// The exporters report errors through onError, so that Update can
+	// replace the OnError hook.
+	onError := &errorHandler{onError: o.OnError}
+	o.OnError = onError.handle
+
 	se, err := newStatsExporter(o)
 	if err != nil {
 		return nil, err
 	}
+	if o.EnableSpanMetrics {
+		if err := view.Register(SpanMetricsViews...); err != nil {
+			return nil, fmt.Errorf("stackdriver: register span metrics views: %v", err)
+		}
+	}
 	te, err := newTraceExporter(o)
 	if err != nil {
 		return nil, err
@@ -348,6 +507,7 @@ func NewExporter(o Options) (*Exporter, error) {
 	return &Exporter{
 		statsExporter: se,
 		traceExporter: te,
+		onError:       onError,
 	}, nil
 }
 
@@ -400,16 +560,41 @@ func (e *Exporter) StopMetricsExporter() {
 
 // ExportSpan exports a SpanData to Stackdriver Trace.
 func (e *Exporter) ExportSpan(sd *trace.SpanData) {
-	if len(e.traceExporter.o.DefaultTraceAttributes) > 0 {
-		sd = e.sdWithDefaultTraceAttributes(sd)
+	if e.traceExporter.o.EnableSpanMetrics {
+		recordSpanMetrics(sd)
+	}
+	if !e.traceExporter.o.traceSampled(sd) {
+		return
+	}
+	if f := e.traceExporter.spanFilters(); f != nil && f.drop(sd) {
+		return
+	}
+	if attrs := e.traceExporter.defaultTraceAttributes(); len(attrs) > 0 {
+		sd = sdWithDefaultTraceAttributes(sd, attrs)
 	}
 	e.traceExporter.ExportSpan(sd)
 }
 
-func (e *Exporter) sdWithDefaultTraceAttributes(sd *trace.SpanData) *trace.SpanData {
+// ProjectID returns the project traces are exported to, which is
+// Options.ProjectID or the project of the application default credentials.
+func (e *Exporter) ProjectID() string {
+	return e.traceExporter.projectID
+}
+
+// FilteredSpanCounts returns the number of spans dropped so far by each of
+// Options.SpanFilters, keyed by filter name.
+func (e *Exporter) FilteredSpanCounts() map[string]int64 {
+	f := e.traceExporter.spanFilters()
+	if f == nil {
+		return map[string]int64{}
+	}
+	return f.snapshot()
+}
+
+func sdWithDefaultTraceAttributes(sd *trace.SpanData, attrs map[string]interface{}) *trace.SpanData {
 	newSD := *sd
 	newSD.Attributes = make(map[string]interface{})
-	for k, v := range e.traceExporter.o.DefaultTraceAttributes {
+	for k, v := range attrs {
 		newSD.Attributes[k] = v
 	}
 	for k, v := range sd.Attributes {
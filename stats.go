@@ -59,9 +59,13 @@ var userAgent = fmt.Sprintf("opencensus-go %s; stackdriver-exporter %s", opencen
 type statsExporter struct {
 	o Options
 
+	// mu guards the bundlers and default labels, which Exporter.Update
+	// replaces.
+	mu                  sync.RWMutex
 	viewDataBundler     *bundler.Bundler
 	protoMetricsBundler *bundler.Bundler
 	metricsBundler      *bundler.Bundler
+	defaultLabels       map[string]labelValue
 
 	createdViewsMu sync.Mutex
 	createdViews   map[string]*metricpb.MetricDescriptor // Views already created remotely
@@ -72,9 +76,13 @@ type statsExporter struct {
 	metricMu          sync.Mutex
 	metricDescriptors map[string]*metricpb.MetricDescriptor // Saves the metric descriptors that were already created remotely
 
-	c             *monitoring.MetricClient
-	defaultLabels map[string]labelValue
-	ir            *metricexport.IntervalReader
+	routedMu                sync.Mutex
+	routedMetricDescriptors map[string]struct{} // Metric descriptors already created in projects other than ProjectID
+
+	resources *resourceValidator
+
+	c  *monitoring.MetricClient
+	ir *metricexport.IntervalReader
 
 	initReaderOnce sync.Once
 }
@@ -106,16 +114,27 @@ func newStatsExporter(o Options) (*statsExporter, error) {
 		createdViews:           make(map[string]*metricpb.MetricDescriptor),
 		protoMetricDescriptors: make(map[string]*metricpb.MetricDescriptor),
 		metricDescriptors:      make(map[string]*metricpb.MetricDescriptor),
+		resources:              newResourceValidator(o),
 	}
 
+	e.defaultLabels = defaultLabelsFromOptions(o)
+	e.newBundlers(o)
+	return e, nil
+}
+
+// defaultLabelsFromOptions returns the labels added to every metric.
+func defaultLabelsFromOptions(o Options) map[string]labelValue {
 	if o.DefaultMonitoringLabels != nil {
-		e.defaultLabels = o.DefaultMonitoringLabels.m
-	} else {
-		e.defaultLabels = map[string]labelValue{
-			opencensusTaskKey: {val: getTaskValue(), desc: opencensusTaskDescription},
-		}
+		return o.DefaultMonitoringLabels.m
+	}
+	return map[string]labelValue{
+		opencensusTaskKey: {val: getTaskValue(), desc: opencensusTaskDescription},
 	}
+}
 
+// newBundlers replaces the bundlers of e by bundlers configured by the
+// bundle options in o. The caller must hold e.mu unless e is being created.
+func (e *statsExporter) newBundlers(o Options) {
 	e.viewDataBundler = bundler.NewBundler((*view.Data)(nil), func(bundle interface{}) {
 		vds := bundle.([]*view.Data)
 		e.handleUpload(vds...)
@@ -128,17 +147,31 @@ func newStatsExporter(o Options) (*statsExporter, error) {
 		metrics := bundle.([]*metricdata.Metric)
 		e.handleMetricsUpload(metrics)
 	})
-	if delayThreshold := e.o.BundleDelayThreshold; delayThreshold > 0 {
+	if delayThreshold := o.BundleDelayThreshold; delayThreshold > 0 {
 		e.viewDataBundler.DelayThreshold = delayThreshold
 		e.protoMetricsBundler.DelayThreshold = delayThreshold
 		e.metricsBundler.DelayThreshold = delayThreshold
 	}
-	if countThreshold := e.o.BundleCountThreshold; countThreshold > 0 {
+	if countThreshold := o.BundleCountThreshold; countThreshold > 0 {
 		e.viewDataBundler.BundleCountThreshold = countThreshold
 		e.protoMetricsBundler.BundleCountThreshold = countThreshold
 		e.metricsBundler.BundleCountThreshold = countThreshold
 	}
-	return e, nil
+}
+
+// bundlers returns the bundlers new view data, proto metrics and metrics
+// are added to.
+func (e *statsExporter) bundlers() (viewData, protoMetrics, metrics *bundler.Bundler) {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+	return e.viewDataBundler, e.protoMetricsBundler, e.metricsBundler
+}
+
+// labels returns the labels added to every metric.
+func (e *statsExporter) labels() map[string]labelValue {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+	return e.defaultLabels
 }
 
 func (e *statsExporter) startMetricsReader() error {
@@ -158,15 +191,21 @@ func (e *statsExporter) stopMetricsReader() {
 func (e *statsExporter) getMonitoredResource(v *view.View, tags []tag.Tag) ([]tag.Tag, *monitoredrespb.MonitoredResource) {
 	if get := e.o.GetMonitoredResource; get != nil {
 		newTags, mr := get(v, tags)
-		return newTags, convertMonitoredResourceToPB(mr)
+		return newTags, e.resources.validate(convertMonitoredResourceToPB(mr))
 	}
+	return tags, e.defaultMonitoredResource()
+}
+
+// defaultMonitoredResource returns the validated Options.Resource, or the
+// global resource if it is not set.
+func (e *statsExporter) defaultMonitoredResource() *monitoredrespb.MonitoredResource {
 	resource := e.o.Resource
 	if resource == nil {
 		resource = &monitoredrespb.MonitoredResource{
 			Type: "global",
 		}
 	}
-	return tags, resource
+	return e.resources.validate(resource)
 }
 
 // ExportView exports to the Stackdriver Monitoring if view data
@@ -175,7 +214,8 @@ func (e *statsExporter) ExportView(vd *view.Data) {
 	if len(vd.Rows) == 0 {
 		return
 	}
-	err := e.viewDataBundler.Add(vd, 1)
+	viewDataBundler, _, _ := e.bundlers()
+	err := viewDataBundler.Add(vd, 1)
 	switch err {
 	case nil:
 		return
@@ -209,9 +249,10 @@ func (e *statsExporter) handleUpload(vds ...*view.Data) {
 // This is useful if your program is ending and you do not
 // want to lose data that hasn't yet been exported.
 func (e *statsExporter) Flush() {
-	e.viewDataBundler.Flush()
-	e.protoMetricsBundler.Flush()
-	e.metricsBundler.Flush()
+	viewData, protoMetrics, metrics := e.bundlers()
+	viewData.Flush()
+	protoMetrics.Flush()
+	metrics.Flush()
 }
 
 func (e *statsExporter) uploadStats(vds []*view.Data) error {
@@ -230,7 +271,23 @@ func (e *statsExporter) uploadStats(vds []*view.Data) error {
 			return err
 		}
 	}
-	for _, req := range e.makeReq(vds, maxTimeSeriesPerUpload) {
+	reqs := e.makeReq(vds, maxTimeSeriesPerUpload)
+	if e.o.GetTimeSeriesProjectID != nil {
+		mds := make(map[string]*metricpb.MetricDescriptor)
+		for _, vd := range vds {
+			md, err := e.viewToMetricDescriptor(ctx, vd.View)
+			if err != nil {
+				span.SetStatus(trace.Status{Code: 2, Message: err.Error()})
+				return err
+			}
+			mds[md.Type] = md
+		}
+		if err := e.createRoutedMetricDescriptors(ctx, reqs, mds); err != nil {
+			span.SetStatus(trace.Status{Code: 2, Message: err.Error()})
+			return err
+		}
+	}
+	for _, req := range reqs {
 		if err := createTimeSeries(ctx, e.c, req); err != nil {
 			span.SetStatus(trace.Status{Code: 2, Message: err.Error()})
 			// TODO(jbd): Don't fail fast here, batch errors?
@@ -243,14 +300,26 @@ func (e *statsExporter) uploadStats(vds []*view.Data) error {
 func (e *statsExporter) makeReq(vds []*view.Data, limit int) []*monitoringpb.CreateTimeSeriesRequest {
 	var reqs []*monitoringpb.CreateTimeSeriesRequest
 
+	defaultLabels := e.labels()
 	var allTimeSeries []*monitoringpb.TimeSeries
 	for _, vd := range vds {
 		for _, row := range vd.Rows {
-			tags, resource := e.getMonitoredResource(vd.View, append([]tag.Tag(nil), row.Tags...))
+			var labels map[string]string
+			var resource *monitoredrespb.MonitoredResource
+			if e.o.GetMetricResource != nil {
+				labels, resource = e.selectMetricResource(viewDescriptor(vd.View), tagLabels(row.Tags), e.o.detectedResource, defaultLabels)
+				if resource == nil {
+					resource = e.defaultMonitoredResource()
+				}
+			} else {
+				var tags []tag.Tag
+				tags, resource = e.getMonitoredResource(vd.View, append([]tag.Tag(nil), row.Tags...))
+				labels = newLabels(defaultLabels, tags)
+			}
 			ts := &monitoringpb.TimeSeries{
 				Metric: &metricpb.Metric{
 					Type:   e.metricType(vd.View),
-					Labels: newLabels(e.defaultLabels, tags),
+					Labels: labels,
 				},
 				Resource: resource,
 				Points:   []*monitoringpb.Point{newPoint(vd.View, row, vd.Start, vd.End)},
@@ -329,7 +398,7 @@ func (e *statsExporter) viewToMetricDescriptor(ctx context.Context, v *view.View
 		Type:        metricType,
 		MetricKind:  metricKind,
 		ValueType:   valueType,
-		Labels:      newLabelDescriptors(e.defaultLabels, v.TagKeys),
+		Labels:      newLabelDescriptors(e.labels(), v.TagKeys),
 	}
 	return res, nil
 }
@@ -569,11 +638,12 @@ func (e *statsExporter) equalMeasureAggTagKeys(md *metricpb.MetricDescriptor, m
 		return fmt.Errorf("stackdriver metric descriptor was not created with aggregation type %T", agg.Type)
 	}
 
-	labels := make(map[string]struct{}, len(keys)+len(e.defaultLabels))
+	defaultLabels := e.labels()
+	labels := make(map[string]struct{}, len(keys)+len(defaultLabels))
 	for _, k := range keys {
 		labels[sanitize(k.Name())] = struct{}{}
 	}
-	for k := range e.defaultLabels {
+	for k := range defaultLabels {
 		labels[sanitize(k)] = struct{}{}
 	}
 
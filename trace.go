@@ -18,6 +18,8 @@ import (
 	"context"
 	"fmt"
 	"log"
+	"runtime"
+	"strings"
 	"sync"
 	"time"
 
@@ -34,9 +36,25 @@ import (
 type traceExporter struct {
 	o         Options
 	projectID string
-	bundler   *bundler.Bundler
+
+	// mu guards the fields that Exporter.Update replaces.
+	mu                sync.RWMutex
+	bundler           *bundler.Bundler
+	defaultAttributes map[string]interface{}
+	// filters drops spans before export; nil if no SpanFilters are set.
+	filters *spanFilters
 	// uploadFn defaults to uploadSpans; it can be replaced for tests.
 	uploadFn func(spans []*tracepb.Span)
+	// protoOpts controls the conversion of spans to protos.
+	protoOpts *spanProtoOptions
+	// redactor scrubs sensitive data; nil if no RedactionRules are set.
+	redactor *redactor
+	// maxSpanBytes is the space for spans in a BatchWriteSpansRequest.
+	maxSpanBytes int
+	// errorReporter reports failed spans; nil unless ErrorReporting is set.
+	errorReporter *errorReporter
+	// stacks deduplicates stack traces attached to spans.
+	stacks stackTraceCache
 	overflowLogger
 	client *tracingclient.Client
 }
@@ -52,17 +70,57 @@ func newTraceExporter(o Options) (*traceExporter, error) {
 	if err != nil {
 		return nil, fmt.Errorf("stackdriver: couldn't initialize trace client: %v", err)
 	}
-	return newTraceExporterWithClient(o, client), nil
+	e := newTraceExporterWithClient(o, client)
+	if o.ErrorReporting != nil {
+		erClient, err := newErrorReportingClient(o)
+		if err != nil {
+			return nil, err
+		}
+		e.errorReporter = newErrorReporter(o, erClient)
+	}
+	return e, nil
 }
 
-const defaultBufferedByteLimit = 8 * 1024 * 1024
+const (
+	defaultBufferedByteLimit = 8 * 1024 * 1024
+	defaultMaxRequestBytes   = 4 * 1024 * 1024
+	// maxRequestNameBytes fits the encoded "projects/<id>" name of any
+	// project, as project IDs have at most 30 characters.
+	maxRequestNameBytes = 64
+)
 
 func newTraceExporterWithClient(o Options, c *tracingclient.Client) *traceExporter {
 	e := &traceExporter{
 		projectID: o.ProjectID,
 		client:    c,
 		o:         o,
+		protoOpts: newSpanProtoOptions(o),
+	}
+	maxRequestBytes := defaultMaxRequestBytes
+	if o.TraceSpansMaxRequestBytes > 0 {
+		maxRequestBytes = o.TraceSpansMaxRequestBytes
 	}
+	// Bundle sizes are the encoded sizes of the spans within a
+	// BatchWriteSpansRequest, so that the request size limit minus the space
+	// for the request name bounds the size of a bundle.
+	e.maxSpanBytes = maxRequestBytes - maxRequestNameBytes
+	e.bundler = e.newBundler(o)
+	e.defaultAttributes = o.DefaultTraceAttributes
+
+	if len(o.SpanFilters) > 0 {
+		e.filters = newSpanFilters(o.SpanFilters)
+	}
+	if len(o.RedactionRules) > 0 {
+		e.redactor = newRedactor(o.RedactionRules, o.OnRedaction)
+	}
+
+	e.uploadFn = e.uploadSpans
+	return e
+}
+
+// newBundler returns a bundler of spans configured by the bundle options
+// in o.
+func (e *traceExporter) newBundler(o Options) *bundler.Bundler {
 	b := bundler.NewBundler((*tracepb.Span)(nil), func(bundle interface{}) {
 		e.uploadFn(bundle.([]*tracepb.Span))
 	})
@@ -76,29 +134,74 @@ func newTraceExporterWithClient(o Options, c *tracingclient.Client) *traceExport
 	} else {
 		b.BundleCountThreshold = 50
 	}
-	// The measured "bytes" are not really bytes, see exportReceiver.
-	b.BundleByteThreshold = b.BundleCountThreshold * 200
-	b.BundleByteLimit = b.BundleCountThreshold * 1000
+	b.BundleByteThreshold = e.maxSpanBytes
+	b.BundleByteLimit = e.maxSpanBytes
 	if o.TraceSpansBufferMaxBytes > 0 {
 		b.BufferedByteLimit = o.TraceSpansBufferMaxBytes
 	} else {
 		b.BufferedByteLimit = defaultBufferedByteLimit
 	}
+	return b
+}
 
-	e.bundler = b
-	e.uploadFn = e.uploadSpans
-	return e
+// currentBundler returns the bundler new spans are added to.
+func (e *traceExporter) currentBundler() *bundler.Bundler {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+	return e.bundler
+}
+
+// spanFilters returns the filters applied to new spans, or nil.
+func (e *traceExporter) spanFilters() *spanFilters {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+	return e.filters
+}
+
+// defaultTraceAttributes returns the attributes added to new spans.
+func (e *traceExporter) defaultTraceAttributes() map[string]interface{} {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+	return e.defaultAttributes
 }
 
 // ExportSpan exports a SpanData to Stackdriver Trace.
 func (e *traceExporter) ExportSpan(s *trace.SpanData) {
-	protoSpan := protoFromSpanData(s, e.projectID, e.o.Resource)
+	if e.redactor != nil {
+		s = e.redactor.redact(s)
+	}
+	projectID := e.spanProjectID(s)
+	mr := e.spanResource(s, projectID)
+	protoSpan := protoFromSpanData(s, projectID, mr, e.protoOpts)
+	// The rate limit of Error Reporting is checked first, so that spans
+	// only need their stack trace captured for events actually sent.
+	reportError := e.errorReporter != nil && s.Status.Code != trace.StatusCodeOK && e.errorReporter.allow()
+	var frames []runtime.Frame
+	if captureStack := shouldCaptureStackTrace(e.o, s); captureStack || reportError {
+		frames = captureStackTrace()
+		if captureStack {
+			protoSpan.StackTrace = e.stacks.stackTraceProto(s.TraceID, frames)
+		}
+	}
+	if !e.protoOpts.limits.trimSpan(protoSpan, e.maxSpanBytes-spanFieldOverhead(e.maxSpanBytes)) {
+		e.o.handleError(fmt.Errorf("stackdriver: span %q does not fit in a request of %d bytes", s.Name, e.maxSpanBytes))
+		return
+	}
 	protoSize := proto.Size(protoSpan)
-	err := e.bundler.Add(protoSpan, protoSize)
+	err := e.currentBundler().Add(protoSpan, protoSize+spanFieldOverhead(protoSize))
 	switch err {
 	case nil:
+		// The frames are only referenced by hash in later spans of the
+		// trace if they were not trimmed from this one.
+		if protoSpan.StackTrace != nil {
+			e.stacks.markSent(s.TraceID, protoSpan.StackTrace)
+		}
+		// Errors are only reported for spans that are uploaded, so that
+		// the trace linked from the event exists.
+		if reportError {
+			e.errorReporter.report(s, projectID, mr, frames)
+		}
 		return
-	case bundler.ErrOversizedItem:
 	case bundler.ErrOverflow:
 		e.overflowLogger.log()
 	default:
@@ -106,20 +209,25 @@ func (e *traceExporter) ExportSpan(s *trace.SpanData) {
 	}
 }
 
+// spanFieldOverhead returns the bytes taken by the field tag and length of a
+// span of the given size within a BatchWriteSpansRequest.
+func spanFieldOverhead(size int) int {
+	return 1 + proto.SizeVarint(uint64(size))
+}
+
 // Flush waits for exported trace spans to be uploaded.
 //
 // This is useful if your program is ending and you do not want to lose recent
 // spans.
 func (e *traceExporter) Flush() {
-	e.bundler.Flush()
+	e.currentBundler().Flush()
+	if e.errorReporter != nil {
+		e.errorReporter.Flush()
+	}
 }
 
 // uploadSpans uploads a set of spans to Stackdriver.
 func (e *traceExporter) uploadSpans(spans []*tracepb.Span) {
-	req := tracepb.BatchWriteSpansRequest{
-		Name:  "projects/" + e.projectID,
-		Spans: spans,
-	}
 	// Create a never-sampled span to prevent traces associated with exporter.
 	ctx, cancel := e.o.newContextWithTimeout()
 	defer cancel()
@@ -131,11 +239,36 @@ func (e *traceExporter) uploadSpans(spans []*tracepb.Span) {
 	defer span.End()
 	span.AddAttributes(trace.Int64Attribute("num_spans", int64(len(spans))))
 
-	err := e.client.BatchWriteSpans(ctx, &req)
-	if err != nil {
-		span.SetStatus(trace.Status{Code: 2, Message: err.Error()})
-		e.o.handleError(err)
+	for _, req := range e.batchWriteSpansRequests(spans) {
+		err := e.client.BatchWriteSpans(ctx, req)
+		if err != nil {
+			span.SetStatus(trace.Status{Code: 2, Message: err.Error()})
+			e.o.handleError(err)
+		}
+	}
+}
+
+// batchWriteSpansRequests returns one BatchWriteSpansRequest per project
+// that spans are routed to, in the order the projects are first seen.
+func (e *traceExporter) batchWriteSpansRequests(spans []*tracepb.Span) []*tracepb.BatchWriteSpansRequest {
+	var reqs []*tracepb.BatchWriteSpansRequest
+	byProject := make(map[string]*tracepb.BatchWriteSpansRequest)
+	for _, sp := range spans {
+		projectID := e.projectID
+		if name := strings.TrimPrefix(sp.Name, "projects/"); name != sp.Name {
+			if i := strings.Index(name, "/"); i > 0 {
+				projectID = name[:i]
+			}
+		}
+		req, ok := byProject[projectID]
+		if !ok {
+			req = &tracepb.BatchWriteSpansRequest{Name: "projects/" + projectID}
+			byProject[projectID] = req
+			reqs = append(reqs, req)
+		}
+		req.Spans = append(req.Spans, sp)
 	}
+	return reqs
 }
 
 // overflowLogger ensures that at most one overflow error log message is
@@ -0,0 +1,149 @@
+// Copyright 2019, OpenCensus Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package stackdriver
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+
+	"go.opencensus.io/plugin/ochttp"
+)
+
+// AttributeAction determines what happens to a span attribute matched by an
+// AttributeRule.
+type AttributeAction int
+
+const (
+	// AttributeRename exports the attribute under AttributeRule.NewKey.
+	AttributeRename AttributeAction = iota
+	// AttributeDrop removes the attribute from the exported span.
+	AttributeDrop
+	// AttributeHash replaces the attribute value with the hex encoded SHA-256
+	// digest of its string form, keyed with AttributeRule.HashKey if set. If
+	// AttributeRule.NewKey is set the attribute is also renamed.
+	//
+	// Without a HashKey the digest is not anonymisation: low-entropy values
+	// such as user IDs, emails or credit card numbers are recovered by
+	// hashing candidate values. Set a secret HashKey for those.
+	AttributeHash
+)
+
+// AttributeRule describes how an attribute with a given key is exported to
+// Stackdriver Trace. Rules apply to span, annotation and link attributes alike.
+type AttributeRule struct {
+	// Key is the OpenCensus attribute key the rule applies to.
+	Key string
+
+	// Action is the action applied to matching attributes.
+	Action AttributeAction
+
+	// NewKey is the key the attribute is exported under.
+	// Required for AttributeRename, optional for AttributeHash.
+	NewKey string
+
+	// HashKey is the secret key of the HMAC-SHA256 used by AttributeHash.
+	// Optional.
+	HashKey []byte
+}
+
+// OCHTTPAttributeRules maps the attributes set by the ochttp plugin to the
+// labels recognized by Stackdriver Trace. It is used when Options.AttributeRules
+// is nil.
+var OCHTTPAttributeRules = []AttributeRule{
+	{Key: ochttp.PathAttribute, NewKey: labelHTTPPath},
+	{Key: ochttp.HostAttribute, NewKey: labelHTTPHost},
+	{Key: ochttp.MethodAttribute, NewKey: labelHTTPMethod},
+	{Key: ochttp.UserAgentAttribute, NewKey: labelHTTPUserAgent},
+	{Key: ochttp.StatusCodeAttribute, NewKey: labelHTTPStatusCode},
+}
+
+// GRPCAttributeRules maps the OpenTelemetry RPC attributes to the gRPC labels
+// recognized by Stackdriver Trace.
+var GRPCAttributeRules = []AttributeRule{
+	{Key: "rpc.service", NewKey: labelGRPCService},
+	{Key: "rpc.method", NewKey: labelGRPCMethod},
+	{Key: "rpc.grpc.status_code", NewKey: labelGRPCStatusCode},
+	{Key: "net.peer.name", NewKey: labelGRPCHost},
+}
+
+// OpenTelemetryAttributeRules maps the OpenTelemetry semantic conventions
+// to the well-known labels recognized by Stackdriver Trace.
+var OpenTelemetryAttributeRules = []AttributeRule{
+	{Key: "http.method", NewKey: labelHTTPMethod},
+	{Key: "http.url", NewKey: labelHTTPURL},
+	{Key: "http.host", NewKey: labelHTTPHost},
+	{Key: "http.target", NewKey: labelHTTPPath},
+	{Key: "http.route", NewKey: labelHTTPRoute},
+	{Key: "http.status_code", NewKey: labelHTTPStatusCode},
+	{Key: "http.user_agent", NewKey: labelHTTPUserAgent},
+	{Key: "http.request_content_length", NewKey: labelHTTPRequestSize},
+	{Key: "http.response_content_length", NewKey: labelHTTPResponseSize},
+	{Key: "exception.type", NewKey: labelErrorName},
+	{Key: "exception.message", NewKey: labelErrorMessage},
+}
+
+// attributeMapper is the compiled form of a list of AttributeRules.
+type attributeMapper struct {
+	rules map[string]AttributeRule
+}
+
+var defaultAttributeMapper = newAttributeMapper(OCHTTPAttributeRules)
+
+// newAttributeMapper compiles rules into an attributeMapper. When several
+// rules share a key, the last one wins.
+func newAttributeMapper(rules []AttributeRule) *attributeMapper {
+	m := &attributeMapper{rules: make(map[string]AttributeRule, len(rules))}
+	for _, r := range rules {
+		m.rules[r.Key] = r
+	}
+	return m
+}
+
+// mapAttribute returns the key and value an attribute should be exported
+// with, or ok == false if it should be dropped.
+func (m *attributeMapper) mapAttribute(key string, value interface{}) (string, interface{}, bool) {
+	r, found := m.rules[key]
+	if !found {
+		return key, value, true
+	}
+	switch r.Action {
+	case AttributeDrop:
+		return "", nil, false
+	case AttributeHash:
+		if r.NewKey != "" {
+			key = r.NewKey
+		}
+		return key, hashString(r.HashKey, fmt.Sprint(value)), true
+	default:
+		if r.NewKey != "" {
+			key = r.NewKey
+		}
+		return key, value, true
+	}
+}
+
+// hashString returns the hex encoded HMAC-SHA256 of s with the given key,
+// or the SHA-256 digest of s if key is empty.
+func hashString(key []byte, s string) string {
+	if len(key) == 0 {
+		sum := sha256.Sum256([]byte(s))
+		return hex.EncodeToString(sum[:])
+	}
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(s))
+	return hex.EncodeToString(mac.Sum(nil))
+}
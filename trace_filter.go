@@ -0,0 +1,151 @@
+// Copyright 2019, OpenCensus Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package stackdriver
+
+import (
+	"reflect"
+	"regexp"
+	"sync/atomic"
+	"time"
+
+	"go.opencensus.io/plugin/ochttp"
+	"go.opencensus.io/trace"
+)
+
+// SpanFilter drops the spans it matches before they are exported to
+// Stackdriver Trace. A span matches if it satisfies every condition that is
+// set; a filter without conditions matches nothing.
+type SpanFilter struct {
+	// Name identifies the filter in Exporter.FilteredSpanCounts.
+	Name string
+
+	// NamePattern matches the span name.
+	NamePattern *regexp.Regexp
+
+	// Attributes matches spans carrying all of these attributes with equal
+	// values of the same type, e.g. int64 rather than int for integers.
+	// Values are compared with reflect.DeepEqual, so slices and maps match
+	// by content.
+	Attributes map[string]interface{}
+
+	// DurationBelow matches spans that took less than this duration.
+	DurationBelow time.Duration
+
+	// HTTPPaths matches spans whose ochttp path attribute equals one of
+	// these paths.
+	HTTPPaths []string
+}
+
+// Predefined span filters.
+var (
+	// HealthCheckSpanFilter drops the spans of common health check and
+	// readiness probe endpoints.
+	HealthCheckSpanFilter = SpanFilter{
+		Name:      "health_check",
+		HTTPPaths: []string{"/health", "/healthz", "/readyz", "/livez", "/ready", "/_ah/health"},
+	}
+
+	// ExporterSpanFilter drops the spans of the calls made by this exporter
+	// to the Stackdriver APIs, as traced by the gRPC and HTTP plugins.
+	ExporterSpanFilter = SpanFilter{
+		Name:        "exporter",
+		NamePattern: regexp.MustCompile(`^(contrib\.go\.opencensus\.io/exporter/stackdriver\.|google\.devtools\.cloudtrace\.|google\.monitoring\.)`),
+	}
+)
+
+// matches reports whether sd satisfies every condition of f.
+func (f *SpanFilter) matches(sd *trace.SpanData) bool {
+	conditions := 0
+	if f.NamePattern != nil {
+		if !f.NamePattern.MatchString(sd.Name) {
+			return false
+		}
+		conditions++
+	}
+	for k, want := range f.Attributes {
+		if got, ok := sd.Attributes[k]; !ok || !reflect.DeepEqual(got, want) {
+			return false
+		}
+	}
+	conditions += len(f.Attributes)
+	if f.DurationBelow > 0 {
+		if sd.EndTime.Sub(sd.StartTime) >= f.DurationBelow {
+			return false
+		}
+		conditions++
+	}
+	if len(f.HTTPPaths) > 0 {
+		path, _ := sd.Attributes[ochttp.PathAttribute].(string)
+		found := false
+		for _, p := range f.HTTPPaths {
+			if p == path {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+		conditions++
+	}
+	return conditions > 0
+}
+
+// spanFilters evaluates a list of SpanFilters and counts the spans dropped
+// by each of them.
+type spanFilters struct {
+	filters []SpanFilter
+	counts  []int64 // accessed atomically
+}
+
+func newSpanFilters(filters []SpanFilter) *spanFilters {
+	return &spanFilters{
+		filters: filters,
+		counts:  make([]int64, len(filters)),
+	}
+}
+
+// drop reports whether sd matches any of the filters. Only the first
+// matching filter is counted.
+func (f *spanFilters) drop(sd *trace.SpanData) bool {
+	for i := range f.filters {
+		if f.filters[i].matches(sd) {
+			atomic.AddInt64(&f.counts[i], 1)
+			return true
+		}
+	}
+	return false
+}
+
+// carryOver adds the counts of the filters in old to the filters of f with
+// the same name, so that counts survive a reconfiguration.
+func (f *spanFilters) carryOver(old *spanFilters) {
+	counts := old.snapshot()
+	for i := range f.filters {
+		if n, ok := counts[f.filters[i].Name]; ok {
+			atomic.AddInt64(&f.counts[i], n)
+			delete(counts, f.filters[i].Name)
+		}
+	}
+}
+
+// snapshot returns the number of spans dropped per filter name.
+func (f *spanFilters) snapshot() map[string]int64 {
+	counts := make(map[string]int64, len(f.filters))
+	for i := range f.filters {
+		counts[f.filters[i].Name] += atomic.LoadInt64(&f.counts[i])
+	}
+	return counts
+}
@@ -0,0 +1,89 @@
+// Copyright 2019, OpenCensus Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package stackdriver
+
+import (
+	"reflect"
+	"regexp"
+	"testing"
+	"time"
+
+	"go.opencensus.io/trace"
+	tracepb "google.golang.org/genproto/googleapis/devtools/cloudtrace/v2"
+)
+
+func TestSpanFilters(t *testing.T) {
+	te := newTraceExporterWithClient(Options{
+		BundleCountThreshold: 1,
+		SpanFilters: []SpanFilter{
+			HealthCheckSpanFilter,
+			ExporterSpanFilter,
+			{Name: "fast", DurationBelow: time.Millisecond},
+			{Name: "internal", NamePattern: regexp.MustCompile("^internal/"), Attributes: map[string]interface{}{"sampled": true}},
+			{Name: "empty"},
+		},
+	}, nil)
+	var got []string
+	te.uploadFn = func(spans []*tracepb.Span) {
+		for _, s := range spans {
+			got = append(got, s.DisplayName.Value)
+		}
+	}
+	e := &Exporter{traceExporter: te}
+
+	start := time.Now()
+	end := start.Add(time.Second)
+	for _, sd := range []*trace.SpanData{
+		{Name: "/healthz", StartTime: start, EndTime: end, Attributes: map[string]interface{}{"http.path": "/healthz"}},
+		{Name: "google.devtools.cloudtrace.v2.TraceService.BatchWriteSpans", StartTime: start, EndTime: end},
+		{Name: "cache.get", StartTime: start, EndTime: start.Add(time.Microsecond)},
+		{Name: "internal/job", StartTime: start, EndTime: end, Attributes: map[string]interface{}{"sampled": true}},
+		{Name: "internal/job2", StartTime: start, EndTime: end},
+		{Name: "/users", StartTime: start, EndTime: end, Attributes: map[string]interface{}{"http.path": "/users"}},
+	} {
+		e.ExportSpan(sd)
+	}
+	te.Flush()
+
+	if want := []string{"internal/job2", "/users"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("exported spans = %v; want %v", got, want)
+	}
+	wantCounts := map[string]int64{"health_check": 1, "exporter": 1, "fast": 1, "internal": 1, "empty": 0}
+	if counts := e.FilteredSpanCounts(); !reflect.DeepEqual(counts, wantCounts) {
+		t.Errorf("FilteredSpanCounts() = %v; want %v", counts, wantCounts)
+	}
+}
+
+func TestSpanFilterUncomparableAttributes(t *testing.T) {
+	f := SpanFilter{Attributes: map[string]interface{}{"tags": []string{"a", "b"}}}
+	for _, tt := range []struct {
+		attrs map[string]interface{}
+		want  bool
+	}{
+		{map[string]interface{}{"tags": []string{"a", "b"}}, true},
+		{map[string]interface{}{"tags": []string{"a"}}, false},
+		{map[string]interface{}{"tags": map[string]int{"a": 1}}, false},
+		{map[string]interface{}{"tags": "a,b"}, false},
+	} {
+		if got := f.matches(&trace.SpanData{Attributes: tt.attrs}); got != tt.want {
+			t.Errorf("matches(%v) = %v; want %v", tt.attrs, got, tt.want)
+		}
+	}
+
+	f = SpanFilter{Attributes: map[string]interface{}{"user": "jane"}}
+	if f.matches(&trace.SpanData{Attributes: map[string]interface{}{"user": []string{"jane"}}}) {
+		t.Error("filter on a string matched a slice attribute")
+	}
+}
@@ -0,0 +1,145 @@
+// Copyright 2019, OpenCensus Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package stackdriver
+
+import (
+	"sort"
+	"strings"
+
+	"github.com/golang/protobuf/proto"
+	tracepb "google.golang.org/genproto/googleapis/devtools/cloudtrace/v2"
+)
+
+const (
+	defaultMaxAttributesPerSpan       = 32
+	defaultMaxLinksPerSpan            = 128
+	defaultMaxAttributesPerAnnotation = 32
+)
+
+// DefaultPriorityAttributePrefixes are the attribute key prefixes kept first
+// when a span has more attributes than allowed: the well-known HTTP and gRPC
+// labels, followed by the agent and monitored resource labels.
+var DefaultPriorityAttributePrefixes = []string{"/http/", "/grpc/", "g.co/"}
+
+// SpanLimits caps the number of attributes and links exported per span.
+// Stackdriver Trace rejects the whole upload batch if a single span exceeds
+// its limits, so excess items are dropped and reported in the dropped
+// counts of the span instead.
+//
+// Zero fields default to the Stackdriver Trace limits.
+type SpanLimits struct {
+	// MaxAttributes is the maximum number of attributes per span,
+	// including the agent and monitored resource labels. Defaults to 32.
+	MaxAttributes int
+
+	// MaxLinks is the maximum number of links per span. Defaults to 128.
+	MaxLinks int
+
+	// MaxAnnotationAttributes is the maximum number of attributes per
+	// annotation. Defaults to 32.
+	MaxAnnotationAttributes int
+
+	// PriorityAttributePrefixes decides which attributes survive when a span
+	// or annotation has too many. Attributes whose keys start with an earlier
+	// prefix are kept first, followed by all other attributes in key order.
+	// Defaults to DefaultPriorityAttributePrefixes.
+	PriorityAttributePrefixes []string
+}
+
+// withDefaults returns l with zero fields replaced by their defaults.
+func (l SpanLimits) withDefaults() SpanLimits {
+	if l.MaxAttributes <= 0 {
+		l.MaxAttributes = defaultMaxAttributesPerSpan
+	}
+	if l.MaxLinks <= 0 {
+		l.MaxLinks = defaultMaxLinksPerSpan
+	}
+	if l.MaxAnnotationAttributes <= 0 {
+		l.MaxAnnotationAttributes = defaultMaxAttributesPerAnnotation
+	}
+	if l.PriorityAttributePrefixes == nil {
+		l.PriorityAttributePrefixes = DefaultPriorityAttributePrefixes
+	}
+	return l
+}
+
+// attributePriority returns the rank of key; lower ranks are kept first.
+func (l SpanLimits) attributePriority(key string) int {
+	for i, p := range l.PriorityAttributePrefixes {
+		if strings.HasPrefix(key, p) {
+			return i
+		}
+	}
+	return len(l.PriorityAttributePrefixes)
+}
+
+// limitAttributes removes attributes beyond max from attrs, keeping the ones
+// with the highest priority, and adds them to the dropped count.
+func (l SpanLimits) limitAttributes(attrs *tracepb.Span_Attributes, max int) {
+	if attrs == nil || len(attrs.AttributeMap) <= max {
+		return
+	}
+	keys := make([]string, 0, len(attrs.AttributeMap))
+	for k := range attrs.AttributeMap {
+		keys = append(keys, k)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		pi, pj := l.attributePriority(keys[i]), l.attributePriority(keys[j])
+		if pi != pj {
+			return pi < pj
+		}
+		return keys[i] < keys[j]
+	})
+	for _, k := range keys[max:] {
+		delete(attrs.AttributeMap, k)
+	}
+	attrs.DroppedAttributesCount += clip32(len(keys) - max)
+}
+
+// trimSpan removes data from sp until its encoded size is at most maxBytes,
+// in this order: the stack trace, message events and annotations from the
+// last one, links from the last one, and attributes by ascending priority.
+// Removed items are added to the dropped counts of sp. It reports whether sp
+// fits in maxBytes.
+func (l SpanLimits) trimSpan(sp *tracepb.Span, maxBytes int) bool {
+	fits := func() bool { return proto.Size(sp) <= maxBytes }
+	if fits() {
+		return true
+	}
+	sp.StackTrace = nil
+	if te := sp.TimeEvents; te != nil {
+		for len(te.TimeEvent) > 0 && !fits() {
+			last := te.TimeEvent[len(te.TimeEvent)-1]
+			te.TimeEvent = te.TimeEvent[:len(te.TimeEvent)-1]
+			if last.GetAnnotation() != nil {
+				te.DroppedAnnotationsCount++
+			} else {
+				te.DroppedMessageEventsCount++
+			}
+		}
+	}
+	if links := sp.Links; links != nil {
+		for len(links.Link) > 0 && !fits() {
+			links.Link = links.Link[:len(links.Link)-1]
+			links.DroppedLinksCount++
+		}
+	}
+	if attrs := sp.Attributes; attrs != nil {
+		for n := len(attrs.AttributeMap) - 1; n >= 0 && !fits(); n-- {
+			l.limitAttributes(attrs, n)
+		}
+	}
+	return fits()
+}
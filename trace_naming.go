@@ -0,0 +1,127 @@
+// Copyright 2019, OpenCensus Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package stackdriver
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"go.opencensus.io/trace"
+)
+
+const (
+	defaultClientSpanPrefix = "Sent."
+	defaultServerSpanPrefix = "Recv."
+)
+
+// SpanNamingPolicy controls the display names of spans exported to
+// Stackdriver Trace. The zero value keeps the span name and prefixes client
+// spans with "Sent." and server spans with "Recv.".
+type SpanNamingPolicy struct {
+	// DisablePrefixes turns off the span kind prefixes.
+	DisablePrefixes bool
+
+	// ClientPrefix and ServerPrefix replace the default "Sent." and "Recv."
+	// prefixes of client and server spans.
+	ClientPrefix string
+	ServerPrefix string
+
+	// Template builds the display name from span attributes. Placeholders
+	// in braces refer to attribute keys, e.g. "{http.method} {http.route}".
+	// If any referenced attribute is missing, the span name is used instead.
+	Template string
+
+	// Normalize rewrites the display name before the prefix is added, e.g.
+	// to remove high-cardinality path segments. See NormalizeNumericSegments.
+	Normalize func(name string) string
+}
+
+var templatePlaceholder = regexp.MustCompile(`\{([^{}]+)\}`)
+
+// spanNamer is the compiled form of a SpanNamingPolicy.
+type spanNamer struct {
+	policy       SpanNamingPolicy
+	clientPrefix string
+	serverPrefix string
+}
+
+var defaultSpanNamer = newSpanNamer(SpanNamingPolicy{})
+
+func newSpanNamer(p SpanNamingPolicy) *spanNamer {
+	n := &spanNamer{
+		policy:       p,
+		clientPrefix: defaultClientSpanPrefix,
+		serverPrefix: defaultServerSpanPrefix,
+	}
+	if p.ClientPrefix != "" {
+		n.clientPrefix = p.ClientPrefix
+	}
+	if p.ServerPrefix != "" {
+		n.serverPrefix = p.ServerPrefix
+	}
+	if p.DisablePrefixes {
+		n.clientPrefix, n.serverPrefix = "", ""
+	}
+	return n
+}
+
+// displayName returns the display name of s, before truncation.
+func (n *spanNamer) displayName(s *trace.SpanData) string {
+	name := s.Name
+	if n.policy.Template != "" {
+		if templated, ok := expandTemplate(n.policy.Template, s.Attributes); ok {
+			name = templated
+		}
+	}
+	if n.policy.Normalize != nil {
+		name = n.policy.Normalize(name)
+	}
+	switch s.SpanKind {
+	case trace.SpanKindClient:
+		name = n.clientPrefix + name
+	case trace.SpanKindServer:
+		name = n.serverPrefix + name
+	}
+	return name
+}
+
+// expandTemplate replaces the placeholders in tmpl with attribute values.
+// It returns ok == false if an attribute is missing.
+func expandTemplate(tmpl string, attrs map[string]interface{}) (name string, ok bool) {
+	ok = true
+	name = templatePlaceholder.ReplaceAllStringFunc(tmpl, func(p string) string {
+		v, found := attrs[p[1:len(p)-1]]
+		if !found {
+			ok = false
+			return ""
+		}
+		return fmt.Sprint(v)
+	})
+	return name, ok
+}
+
+// NormalizeNumericSegments replaces every path segment consisting only of
+// digits with ":id", so that "GET /users/42/orders/7" becomes
+// "GET /users/:id/orders/:id".
+func NormalizeNumericSegments(name string) string {
+	segments := strings.Split(name, "/")
+	for i, seg := range segments {
+		if seg != "" && strings.Trim(seg, "0123456789") == "" {
+			segments[i] = ":id"
+		}
+	}
+	return strings.Join(segments, "/")
+}
@@ -15,6 +15,7 @@
 package stackdriver
 
 import (
+	"encoding/json"
 	"fmt"
 	"math"
 	"strconv"
@@ -23,7 +24,6 @@ import (
 
 	timestamppb "github.com/golang/protobuf/ptypes/timestamp"
 	wrapperspb "github.com/golang/protobuf/ptypes/wrappers"
-	"go.opencensus.io/plugin/ochttp"
 	"go.opencensus.io/trace"
 	monitoredrespb "google.golang.org/genproto/googleapis/api/monitoredres"
 	tracepb "google.golang.org/genproto/googleapis/devtools/cloudtrace/v2"
@@ -41,24 +41,65 @@ const (
 	labelHTTPStatusCode = `/http/status_code`
 	labelHTTPPath       = `/http/path`
 	labelHTTPUserAgent  = `/http/user_agent`
+
+	labelHTTPURL          = `/http/url`
+	labelHTTPRoute        = `/http/route`
+	labelHTTPRequestSize  = `/http/request/size`
+	labelHTTPResponseSize = `/http/response/size`
+	labelErrorName        = `/error/name`
+	labelErrorMessage     = `/error/message`
+
+	labelGRPCHost       = `/grpc/host`
+	labelGRPCService    = `/grpc/service`
+	labelGRPCMethod     = `/grpc/method`
+	labelGRPCStatusCode = `/grpc/status_code`
 )
 
+// spanProtoOptions controls how protoFromSpanData converts a SpanData.
+type spanProtoOptions struct {
+	attributes         *attributeMapper
+	naming             *spanNamer
+	jsonAttributes     bool
+	limits             SpanLimits
+	resourceAttributes spanResourceAttributes
+}
+
+var defaultSpanProtoOptions = &spanProtoOptions{
+	attributes: defaultAttributeMapper,
+	naming:     defaultSpanNamer,
+	limits:     SpanLimits{}.withDefaults(),
+}
+
+// newSpanProtoOptions builds the span conversion settings for the given
+// exporter options.
+func newSpanProtoOptions(o Options) *spanProtoOptions {
+	po := &spanProtoOptions{
+		attributes:         defaultAttributeMapper,
+		naming:             newSpanNamer(o.SpanNaming),
+		jsonAttributes:     o.JSONEncodeCompositeAttributes,
+		limits:             o.SpanLimits.withDefaults(),
+		resourceAttributes: newSpanResourceAttributes(o.SpanResource),
+	}
+	if o.AttributeRules != nil {
+		po.attributes = newAttributeMapper(o.AttributeRules)
+	}
+	return po
+}
+
 // proto returns a protocol buffer representation of a SpanData.
-func protoFromSpanData(s *trace.SpanData, projectID string, mr *monitoredrespb.MonitoredResource) *tracepb.Span {
+// A nil po selects the default conversion settings.
+func protoFromSpanData(s *trace.SpanData, projectID string, mr *monitoredrespb.MonitoredResource, po *spanProtoOptions) *tracepb.Span {
 	if s == nil {
 		return nil
 	}
+	if po == nil {
+		po = defaultSpanProtoOptions
+	}
 
 	traceIDString := s.SpanContext.TraceID.String()
 	spanIDString := s.SpanContext.SpanID.String()
 
-	name := s.Name
-	switch s.SpanKind {
-	case trace.SpanKindClient:
-		name = "Sent." + name
-	case trace.SpanKindServer:
-		name = "Recv." + name
-	}
+	name := po.naming.displayName(s)
 
 	sp := &tracepb.Span{
 		Name:                    "projects/" + projectID + "/traces/" + traceIDString + "/spans/" + spanIDString,
@@ -76,10 +117,10 @@ func protoFromSpanData(s *trace.SpanData, projectID string, mr *monitoredrespb.M
 	}
 
 	var annotations, droppedAnnotationsCount, messageEvents, droppedMessageEventsCount int
-	copyAttributes(&sp.Attributes, s.Attributes)
+	po.copyAttributes(&sp.Attributes, s.Attributes)
 
 	// Copy MonitoredResources as span Attributes
-	sp.Attributes = copyMonitoredResourceAttributes(sp.Attributes, mr)
+	sp.Attributes = po.resourceAttributes.copyMonitoredResourceAttributes(sp.Attributes, mr)
 
 	as := s.Annotations
 	for i, a := range as {
@@ -88,7 +129,8 @@ func protoFromSpanData(s *trace.SpanData, projectID string, mr *monitoredrespb.M
 			break
 		}
 		annotation := &tracepb.Span_TimeEvent_Annotation{Description: trunc(a.Message, maxAttributeStringValue)}
-		copyAttributes(&annotation.Attributes, a.Attributes)
+		po.copyAttributes(&annotation.Attributes, a.Attributes)
+		po.limits.limitAttributes(annotation.Attributes, po.limits.MaxAnnotationAttributes)
 		event := &tracepb.Span_TimeEvent{
 			Time:  timestampProto(a.Time),
 			Value: &tracepb.Span_TimeEvent_Annotation_{Annotation: annotation},
@@ -116,6 +158,7 @@ func protoFromSpanData(s *trace.SpanData, projectID string, mr *monitoredrespb.M
 			},
 		}
 	}
+	po.limits.limitAttributes(sp.Attributes, po.limits.MaxAttributes)
 
 	es := s.MessageEvents
 	for i, e := range es {
@@ -149,15 +192,20 @@ func protoFromSpanData(s *trace.SpanData, projectID string, mr *monitoredrespb.M
 	}
 
 	if len(s.Links) > 0 {
+		links := s.Links
 		sp.Links = &tracepb.Span_Links{}
-		sp.Links.Link = make([]*tracepb.Span_Link, 0, len(s.Links))
-		for _, l := range s.Links {
+		if len(links) > po.limits.MaxLinks {
+			sp.Links.DroppedLinksCount = clip32(len(links) - po.limits.MaxLinks)
+			links = links[:po.limits.MaxLinks]
+		}
+		sp.Links.Link = make([]*tracepb.Span_Link, 0, len(links))
+		for _, l := range links {
 			link := &tracepb.Span_Link{
 				TraceId: l.TraceID.String(),
 				SpanId:  l.SpanID.String(),
 				Type:    tracepb.Span_Link_Type(l.Type),
 			}
-			copyAttributes(&link.Attributes, l.Attributes)
+			po.copyAttributes(&link.Attributes, l.Attributes)
 			sp.Links.Link = append(sp.Links.Link, link)
 		}
 	}
@@ -172,28 +220,9 @@ func timestampProto(t time.Time) *timestamppb.Timestamp {
 	}
 }
 
-// copyMonitoredResourceAttributes copies proto monitoredResource to proto map field (Span_Attributes)
-// it creates the map if it is nil.
-func copyMonitoredResourceAttributes(out *tracepb.Span_Attributes, mr *monitoredrespb.MonitoredResource) *tracepb.Span_Attributes {
-	if mr == nil {
-		return out
-	}
-	if out == nil {
-		out = &tracepb.Span_Attributes{}
-	}
-	if out.AttributeMap == nil {
-		out.AttributeMap = make(map[string]*tracepb.AttributeValue)
-	}
-	for k, v := range mr.Labels {
-		av := attributeValue(v)
-		out.AttributeMap[fmt.Sprintf("g.co/r/%s/%s", mr.Type, k)] = av
-	}
-	return out
-}
-
-// copyAttributes copies a map of attributes to a proto map field.
-// It creates the map if it is nil.
-func copyAttributes(out **tracepb.Span_Attributes, in map[string]interface{}) {
+// copyAttributes copies a map of attributes to a proto map field, applying
+// the configured attribute rules. It creates the map if it is nil.
+func (po *spanProtoOptions) copyAttributes(out **tracepb.Span_Attributes, in map[string]interface{}) {
 	if len(in) == 0 {
 		return
 	}
@@ -205,57 +234,122 @@ func copyAttributes(out **tracepb.Span_Attributes, in map[string]interface{}) {
 	}
 	var dropped int32
 	for key, value := range in {
-		av := attributeValue(value)
+		key, value, ok := po.attributes.mapAttribute(key, value)
+		if !ok {
+			dropped++
+			continue
+		}
+		av := po.attributeValue(value)
 		if av == nil {
+			dropped++
 			continue
 		}
-		switch key {
-		case ochttp.PathAttribute:
-			(*out).AttributeMap[labelHTTPPath] = av
-		case ochttp.HostAttribute:
-			(*out).AttributeMap[labelHTTPHost] = av
-		case ochttp.MethodAttribute:
-			(*out).AttributeMap[labelHTTPMethod] = av
-		case ochttp.UserAgentAttribute:
-			(*out).AttributeMap[labelHTTPUserAgent] = av
-		case ochttp.StatusCodeAttribute:
-			(*out).AttributeMap[labelHTTPStatusCode] = av
-		default:
-			if len(key) > 128 {
-				dropped++
-				continue
-			}
-			(*out).AttributeMap[key] = av
+		if len(key) > 128 {
+			dropped++
+			continue
 		}
+		(*out).AttributeMap[key] = av
 	}
 	(*out).DroppedAttributesCount = dropped
 }
 
+// attributeValue converts an attribute value to its proto representation.
+//
+// Stackdriver Trace only supports string, integer and boolean values, so:
+//   - signed and unsigned integers become integer values; unsigned values
+//     that overflow an int64 are formatted as decimal strings,
+//   - floating point numbers are formatted as strings,
+//   - time.Duration values are formatted with Duration.String,
+//   - time.Time values are formatted as RFC 3339 strings,
+//   - errors and fmt.Stringers are formatted with Error and String; nil
+//     pointers of such types are formatted as "<nil>",
+//   - []string values are encoded as JSON arrays.
+//
+// It returns nil for values of any other type.
 func attributeValue(v interface{}) *tracepb.AttributeValue {
 	switch value := v.(type) {
 	case bool:
 		return &tracepb.AttributeValue{
 			Value: &tracepb.AttributeValue_BoolValue{BoolValue: value},
 		}
+	case time.Duration:
+		return stringAttributeValue(value.String())
 	case int64:
-		return &tracepb.AttributeValue{
-			Value: &tracepb.AttributeValue_IntValue{IntValue: value},
-		}
+		return intAttributeValue(value)
+	case int:
+		return intAttributeValue(int64(value))
+	case int32:
+		return intAttributeValue(int64(value))
+	case int16:
+		return intAttributeValue(int64(value))
+	case int8:
+		return intAttributeValue(int64(value))
+	case uint64:
+		return uintAttributeValue(value)
+	case uint:
+		return uintAttributeValue(uint64(value))
+	case uintptr:
+		return uintAttributeValue(uint64(value))
+	case uint32:
+		return intAttributeValue(int64(value))
+	case uint16:
+		return intAttributeValue(int64(value))
+	case uint8:
+		return intAttributeValue(int64(value))
 	case float64:
-		// TODO: set double value if Stackdriver Trace support it in the future.
-		return &tracepb.AttributeValue{
-			Value: &tracepb.AttributeValue_StringValue{
-				StringValue: trunc(strconv.FormatFloat(value, 'f', -1, 64),
-					maxAttributeStringValue)},
-		}
+		return stringAttributeValue(strconv.FormatFloat(value, 'f', -1, 64))
+	case float32:
+		return stringAttributeValue(strconv.FormatFloat(float64(value), 'f', -1, 32))
 	case string:
-		return &tracepb.AttributeValue{
-			Value: &tracepb.AttributeValue_StringValue{StringValue: trunc(value, maxAttributeStringValue)},
+		return stringAttributeValue(value)
+	case time.Time:
+		return stringAttributeValue(value.Format(time.RFC3339Nano))
+	case error, fmt.Stringer:
+		// fmt.Sprint calls Error or String, and recovers from the panic
+		// of a nil pointer receiver.
+		return stringAttributeValue(fmt.Sprint(value))
+	case []string:
+		b, err := json.Marshal(value)
+		if err != nil {
+			return nil
 		}
+		return stringAttributeValue(string(b))
 	}
 	return nil
 }
 
+// attributeValue converts an attribute value like the attributeValue
+// function, but encodes values of other types as JSON strings if enabled.
+func (po *spanProtoOptions) attributeValue(v interface{}) *tracepb.AttributeValue {
+	if av := attributeValue(v); av != nil || !po.jsonAttributes || v == nil {
+		return av
+	}
+	b, err := json.Marshal(v)
+	if err != nil {
+		return nil
+	}
+	return stringAttributeValue(string(b))
+}
+
+func stringAttributeValue(s string) *tracepb.AttributeValue {
+	return &tracepb.AttributeValue{
+		Value: &tracepb.AttributeValue_StringValue{StringValue: trunc(s, maxAttributeStringValue)},
+	}
+}
+
+func intAttributeValue(i int64) *tracepb.AttributeValue {
+	return &tracepb.AttributeValue{
+		Value: &tracepb.AttributeValue_IntValue{IntValue: i},
+	}
+}
+
+func uintAttributeValue(u uint64) *tracepb.AttributeValue {
+	if u > math.MaxInt64 {
+		return stringAttributeValue(strconv.FormatUint(u, 10))
+	}
+	return intAttributeValue(int64(u))
+}
+
 // trunc returns a TruncatableString truncated to the given limit.
 func trunc(s string, limit int) *tracepb.TruncatableString {
 	if len(s) > limit {
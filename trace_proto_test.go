@@ -16,6 +16,7 @@ package stackdriver
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"math/big"
 	"reflect"
@@ -79,8 +80,7 @@ func generateSpan() {
 				trace.StringAttribute(agentLabel, "custom-agent"))
 			span2.AddAttributes(
 				trace.Int64Attribute("key1", 100),
-				// TODO [rghetia]: uncomment the test case after go.opencensus.io/trace@v0.20.0 is released.
-				//trace.Float64Attribute("key3", 100.001),
+				trace.Float64Attribute("key3", 100.001),
 			)
 			span2.End()
 		}
@@ -135,10 +135,9 @@ func createExpectedSpans() spans {
 			DisplayName: trunc("span2", 128),
 			Attributes: &tracepb.Span_Attributes{
 				AttributeMap: map[string]*tracepb.AttributeValue{
-					"key2": {Value: &tracepb.AttributeValue_StringValue{StringValue: trunc("value2", 256)}},
-					"key1": {Value: &tracepb.AttributeValue_IntValue{IntValue: 100}},
-					// TODO [rghetia]: uncomment the test case after go.opencensus.io/trace@v0.20.0 is released.
-					//"key3": {Value: &tracepb.AttributeValue_StringValue{StringValue: trunc("100.001", 256)}},
+					"key2":     {Value: &tracepb.AttributeValue_StringValue{StringValue: trunc("value2", 256)}},
+					"key1":     {Value: &tracepb.AttributeValue_IntValue{IntValue: 100}},
+					"key3":     {Value: &tracepb.AttributeValue_StringValue{StringValue: trunc("100.001", 256)}},
 					agentLabel: {Value: &tracepb.AttributeValue_StringValue{StringValue: trunc("custom-agent", 256)}},
 				},
 			},
@@ -286,7 +285,7 @@ func TestExportTrace(t *testing.T) {
 
 	var spbs spans
 	for _, s := range te.spans {
-		spbs = append(spbs, protoFromSpanData(s, "testproject", nil))
+		spbs = append(spbs, protoFromSpanData(s, "testproject", nil, nil))
 	}
 	sort.Sort(spbs)
 
@@ -398,7 +397,7 @@ func TestExportTraceWithMonitoredResource(t *testing.T) {
 	mr := createGCEInstanceMonitoredResource()
 
 	for _, s := range te.spans {
-		gceSpbs = append(gceSpbs, protoFromSpanData(s, "testproject", mr))
+		gceSpbs = append(gceSpbs, protoFromSpanData(s, "testproject", mr, nil))
 	}
 
 	for _, span := range gceSpbs {
@@ -412,7 +411,7 @@ func TestExportTraceWithMonitoredResource(t *testing.T) {
 	mr = createGKEContainerMonitoredResource()
 
 	for _, s := range te.spans {
-		gkeSpbs = append(gkeSpbs, protoFromSpanData(s, "testproject", mr))
+		gkeSpbs = append(gkeSpbs, protoFromSpanData(s, "testproject", mr, nil))
 	}
 
 	for _, span := range gkeSpbs {
@@ -429,7 +428,7 @@ func TestExportTraceWithMonitoredResource(t *testing.T) {
 	var awsEc2Spbs spans
 	mr = createAWSEC2MonitoredResource()
 	for _, s := range te.spans {
-		awsEc2Spbs = append(awsEc2Spbs, protoFromSpanData(s, "testproject", mr))
+		awsEc2Spbs = append(awsEc2Spbs, protoFromSpanData(s, "testproject", mr, nil))
 	}
 
 	for _, span := range awsEc2Spbs {
@@ -502,10 +501,249 @@ func BenchmarkProto(b *testing.B) {
 	}
 	var x int
 	for i := 0; i < b.N; i++ {
-		s := protoFromSpanData(sd, `testproject`, nil)
+		s := protoFromSpanData(sd, `testproject`, nil, nil)
 		x += len(s.Name)
 	}
 	if x == 0 {
 		fmt.Println(x)
 	}
 }
+
+func TestAttributeRules(t *testing.T) {
+	rules := append(append([]AttributeRule{}, OCHTTPAttributeRules...), GRPCAttributeRules...)
+	rules = append(rules,
+		AttributeRule{Key: "user.email", Action: AttributeHash},
+		AttributeRule{Key: "secret", Action: AttributeDrop},
+		AttributeRule{Key: "http.path", NewKey: "/http/route"},
+	)
+	po := newSpanProtoOptions(Options{AttributeRules: rules})
+	attrs := map[string]interface{}{
+		"http.path":   "/users/42",
+		"http.method": "GET",
+		"rpc.method":  "Get",
+		"user.email":  "jane@example.com",
+		"secret":      "s3cr3t",
+		"other":       int64(7),
+	}
+	sd := &trace.SpanData{
+		Name:        "span",
+		Attributes:  attrs,
+		Annotations: []trace.Annotation{{Message: "a", Attributes: attrs}},
+		Links:       []trace.Link{{Attributes: attrs}},
+	}
+	sp := protoFromSpanData(sd, "testproject", nil, po)
+
+	check := func(what string, got *tracepb.Span_Attributes) {
+		want := map[string]*tracepb.AttributeValue{
+			"/http/route":  {Value: &tracepb.AttributeValue_StringValue{StringValue: trunc("/users/42", 256)}},
+			"/http/method": {Value: &tracepb.AttributeValue_StringValue{StringValue: trunc("GET", 256)}},
+			"/grpc/method": {Value: &tracepb.AttributeValue_StringValue{StringValue: trunc("Get", 256)}},
+			"user.email":   {Value: &tracepb.AttributeValue_StringValue{StringValue: trunc(hashString(nil, "jane@example.com"), 256)}},
+			"other":        {Value: &tracepb.AttributeValue_IntValue{IntValue: 7}},
+		}
+		delete(got.AttributeMap, agentLabel)
+		if !reflect.DeepEqual(got.AttributeMap, want) {
+			t.Errorf("%s attributes = %v; want %v", what, got.AttributeMap, want)
+		}
+		if got.DroppedAttributesCount != 1 {
+			t.Errorf("%s dropped attributes = %d; want 1", what, got.DroppedAttributesCount)
+		}
+	}
+	check("span", sp.Attributes)
+	check("annotation", sp.TimeEvents.TimeEvent[0].GetAnnotation().Attributes)
+	check("link", sp.Links.Link[0].Attributes)
+
+	// An empty rule set exports keys unchanged.
+	sp = protoFromSpanData(sd, "testproject", nil, newSpanProtoOptions(Options{AttributeRules: []AttributeRule{}}))
+	if _, ok := sp.Attributes.AttributeMap["http.path"]; !ok {
+		t.Errorf("http.path was renamed with empty rules: %v", sp.Attributes.AttributeMap)
+	}
+}
+
+func TestAttributeHashKey(t *testing.T) {
+	m := newAttributeMapper([]AttributeRule{{Key: "user.id", Action: AttributeHash, HashKey: []byte("Jefe")}})
+	_, got, _ := m.mapAttribute("user.id", "what do ya want for nothing?")
+	// HMAC-SHA256 test case 2 of RFC 4231.
+	if want := "5bdcc146bf60754e6a042426089575c75a003f089d2739839dec58b964ec3843"; got != want {
+		t.Errorf("hashed value = %v; want %v", got, want)
+	}
+}
+
+func TestSpanNaming(t *testing.T) {
+	attrs := map[string]interface{}{
+		"http.method": "GET",
+		"http.path":   "/users/42/orders/7",
+	}
+	for _, tt := range []struct {
+		name   string
+		policy SpanNamingPolicy
+		sd     *trace.SpanData
+		want   string
+	}{
+		{
+			name: "default",
+			sd:   &trace.SpanData{Name: "span", SpanKind: trace.SpanKindClient},
+			want: "Sent.span",
+		},
+		{
+			name:   "disabled prefixes",
+			policy: SpanNamingPolicy{DisablePrefixes: true},
+			sd:     &trace.SpanData{Name: "span", SpanKind: trace.SpanKindServer},
+			want:   "span",
+		},
+		{
+			name:   "custom prefix",
+			policy: SpanNamingPolicy{ServerPrefix: "server: "},
+			sd:     &trace.SpanData{Name: "span", SpanKind: trace.SpanKindServer},
+			want:   "server: span",
+		},
+		{
+			name:   "template and normalization",
+			policy: SpanNamingPolicy{Template: "{http.method} {http.path}", Normalize: NormalizeNumericSegments},
+			sd:     &trace.SpanData{Name: "span", SpanKind: trace.SpanKindServer, Attributes: attrs},
+			want:   "Recv.GET /users/:id/orders/:id",
+		},
+		{
+			name:   "template with missing attribute",
+			policy: SpanNamingPolicy{Template: "{http.method} {http.route}"},
+			sd:     &trace.SpanData{Name: "span", Attributes: attrs},
+			want:   "span",
+		},
+	} {
+		po := newSpanProtoOptions(Options{SpanNaming: tt.policy})
+		if got := protoFromSpanData(tt.sd, "testproject", nil, po).DisplayName.Value; got != tt.want {
+			t.Errorf("%s: DisplayName = %q; want %q", tt.name, got, tt.want)
+		}
+	}
+}
+
+type stringer struct{}
+
+func (stringer) String() string { return "stringer" }
+
+type ptrError struct{ msg string }
+
+func (e *ptrError) Error() string { return e.msg }
+
+type ptrStringer struct{ s string }
+
+func (p *ptrStringer) String() string { return p.s }
+
+func TestAttributeValueTypes(t *testing.T) {
+	str := func(s string) *tracepb.AttributeValue {
+		return &tracepb.AttributeValue{Value: &tracepb.AttributeValue_StringValue{StringValue: trunc(s, 256)}}
+	}
+	num := func(i int64) *tracepb.AttributeValue {
+		return &tracepb.AttributeValue{Value: &tracepb.AttributeValue_IntValue{IntValue: i}}
+	}
+	ts := time.Date(2019, 8, 28, 12, 0, 0, 0, time.UTC)
+	attrs := map[string]interface{}{
+		"int":       42,
+		"int32":     int32(-3),
+		"uint8":     uint8(8),
+		"uint64":    uint64(1 << 63),
+		"float32":   float32(1.5),
+		"float64":   2.25,
+		"duration":  1500 * time.Millisecond,
+		"time":      ts,
+		"error":     errors.New("boom"),
+		"stringer":  stringer{},
+		"nilerror":  (*ptrError)(nil),
+		"nilstring": (*ptrStringer)(nil),
+		"slice":     []string{"a", "b"},
+		"map":       map[string]int{"a": 1},
+		"nil":       nil,
+		"bool":      true,
+		"string":    "s",
+		"int64":     int64(-1),
+		"uint":      uint(7),
+		"unsupport": func() {},
+	}
+	want := map[string]*tracepb.AttributeValue{
+		"int":       num(42),
+		"int32":     num(-3),
+		"uint8":     num(8),
+		"uint64":    str("9223372036854775808"),
+		"float32":   str("1.5"),
+		"float64":   str("2.25"),
+		"duration":  str("1.5s"),
+		"time":      str("2019-08-28T12:00:00Z"),
+		"error":     str("boom"),
+		"stringer":  str("stringer"),
+		"nilerror":  str("<nil>"),
+		"nilstring": str("<nil>"),
+		"slice":     str(`["a","b"]`),
+		"bool":      {Value: &tracepb.AttributeValue_BoolValue{BoolValue: true}},
+		"string":    str("s"),
+		"int64":     num(-1),
+		"uint":      num(7),
+	}
+
+	sp := protoFromSpanData(&trace.SpanData{Attributes: attrs}, "testproject", nil, nil)
+	delete(sp.Attributes.AttributeMap, agentLabel)
+	if !reflect.DeepEqual(sp.Attributes.AttributeMap, want) {
+		t.Errorf("AttributeMap = %v; want %v", sp.Attributes.AttributeMap, want)
+	}
+	if got := sp.Attributes.DroppedAttributesCount; got != 3 {
+		t.Errorf("DroppedAttributesCount = %d; want 3", got)
+	}
+
+	po := newSpanProtoOptions(Options{JSONEncodeCompositeAttributes: true})
+	sp = protoFromSpanData(&trace.SpanData{Attributes: attrs}, "testproject", nil, po)
+	want["map"] = str(`{"a":1}`)
+	delete(sp.Attributes.AttributeMap, agentLabel)
+	if !reflect.DeepEqual(sp.Attributes.AttributeMap, want) {
+		t.Errorf("AttributeMap with JSON = %v; want %v", sp.Attributes.AttributeMap, want)
+	}
+	if got := sp.Attributes.DroppedAttributesCount; got != 2 {
+		t.Errorf("DroppedAttributesCount with JSON = %d; want 2", got)
+	}
+}
+
+func TestSpanLimits(t *testing.T) {
+	sd := &trace.SpanData{
+		Name:       "span",
+		Attributes: map[string]interface{}{"http.method": "GET"},
+		Links:      make([]trace.Link, 5),
+		Annotations: []trace.Annotation{
+			{Message: "a", Attributes: map[string]interface{}{"a1": "v", "a2": "v", "a3": "v"}},
+		},
+	}
+	for i := 0; i < 40; i++ {
+		sd.Attributes[fmt.Sprintf("attr-%02d", i)] = int64(i)
+	}
+	mr := createGCEInstanceMonitoredResource()
+
+	sp := protoFromSpanData(sd, "testproject", mr, nil)
+	if got := len(sp.Attributes.AttributeMap); got != 32 {
+		t.Errorf("got %d attributes; want 32", got)
+	}
+	// 41 span attributes, 3 resource labels and the agent label.
+	if got := sp.Attributes.DroppedAttributesCount; got != 13 {
+		t.Errorf("DroppedAttributesCount = %d; want 13", got)
+	}
+	for _, k := range []string{labelHTTPMethod, agentLabel, "g.co/r/gce_instance/zone", "attr-00"} {
+		if _, ok := sp.Attributes.AttributeMap[k]; !ok {
+			t.Errorf("priority attribute %q was dropped", k)
+		}
+	}
+	if _, ok := sp.Attributes.AttributeMap["attr-39"]; ok {
+		t.Errorf("low priority attribute attr-39 was kept")
+	}
+
+	po := newSpanProtoOptions(Options{SpanLimits: SpanLimits{MaxAttributes: 2, MaxLinks: 3, MaxAnnotationAttributes: 1}})
+	sp = protoFromSpanData(sd, "testproject", nil, po)
+	if got := len(sp.Attributes.AttributeMap); got != 2 {
+		t.Errorf("got %d attributes; want 2", got)
+	}
+	if got, want := len(sp.Links.Link), 3; got != want {
+		t.Errorf("got %d links; want %d", got, want)
+	}
+	if got := sp.Links.DroppedLinksCount; got != 2 {
+		t.Errorf("DroppedLinksCount = %d; want 2", got)
+	}
+	ann := sp.TimeEvents.TimeEvent[0].GetAnnotation()
+	if len(ann.Attributes.AttributeMap) != 1 || ann.Attributes.DroppedAttributesCount != 2 {
+		t.Errorf("annotation attributes = %v; want 1 kept and 2 dropped", ann.Attributes)
+	}
+}
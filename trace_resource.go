@@ -0,0 +1,120 @@
+// Copyright 2019, OpenCensus Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package stackdriver
+
+import (
+	"fmt"
+
+	"github.com/golang/protobuf/proto"
+	"go.opencensus.io/trace"
+	monitoredrespb "google.golang.org/genproto/googleapis/api/monitoredres"
+	tracepb "google.golang.org/genproto/googleapis/devtools/cloudtrace/v2"
+)
+
+// SpanResourceOptions controls which monitored resource labels are attached
+// to spans as attributes. By default every label of the resource is
+// attached as "g.co/r/<resource type>/<label>".
+type SpanResourceOptions struct {
+	// Labels lists the monitored resource labels attached to spans, such as
+	// "zone" or "cluster_name". An empty, non-nil list attaches no labels.
+	// Optional. By default all labels are attached.
+	Labels []string
+
+	// WellKnownAttributes attaches the labels listed in
+	// WellKnownResourceAttributes under the attribute names that Cloud Trace
+	// recognises, instead of "g.co/r/<resource type>/<label>".
+	// Optional.
+	WellKnownAttributes bool
+
+	// GetResource returns the monitored resource of a span.
+	// Optional. By default the resource of the exporter is used, whether set
+	// by Resource, MonitoredResource or ResourceDetector; if GetSpanProjectID
+	// routes the span to another project, the project_id label is set to
+	// that project.
+	GetResource func(*trace.SpanData) *monitoredrespb.MonitoredResource
+}
+
+// WellKnownResourceAttributes maps monitored resource labels, written as
+// "<resource type>/<label>", to the span attributes Cloud Trace recognises
+// for them. It is used if SpanResourceOptions.WellKnownAttributes is set.
+// Labels that are not listed keep their "g.co/r/<resource type>/<label>"
+// attribute names.
+var WellKnownResourceAttributes = map[string]string{
+	"gce_instance/instance_id":  "g.co/gce/instanceid",
+	"gke_container/instance_id": "g.co/gce/instanceid",
+	"gae_instance/module_id":    "g.co/gae/app/module",
+	"gae_instance/version_id":   "g.co/gae/app/version",
+}
+
+// spanResourceAttributes controls the conversion of monitored resource
+// labels to span attributes.
+type spanResourceAttributes struct {
+	labels    map[string]bool // nil selects all labels
+	wellKnown bool
+}
+
+func newSpanResourceAttributes(o SpanResourceOptions) spanResourceAttributes {
+	ra := spanResourceAttributes{wellKnown: o.WellKnownAttributes}
+	if o.Labels != nil {
+		ra.labels = make(map[string]bool, len(o.Labels))
+		for _, l := range o.Labels {
+			ra.labels[l] = true
+		}
+	}
+	return ra
+}
+
+// copyMonitoredResourceAttributes copies the selected labels of mr to span
+// attributes. It creates the map if it is nil.
+func (ra spanResourceAttributes) copyMonitoredResourceAttributes(out *tracepb.Span_Attributes, mr *monitoredrespb.MonitoredResource) *tracepb.Span_Attributes {
+	if mr == nil {
+		return out
+	}
+	if out == nil {
+		out = &tracepb.Span_Attributes{}
+	}
+	if out.AttributeMap == nil {
+		out.AttributeMap = make(map[string]*tracepb.AttributeValue)
+	}
+	for k, v := range mr.Labels {
+		if ra.labels != nil && !ra.labels[k] {
+			continue
+		}
+		name := fmt.Sprintf("g.co/r/%s/%s", mr.Type, k)
+		if wellKnown, ok := WellKnownResourceAttributes[mr.Type+"/"+k]; ok && ra.wellKnown {
+			name = wellKnown
+		}
+		out.AttributeMap[name] = attributeValue(v)
+	}
+	return out
+}
+
+// spanResource returns the monitored resource of s, which is exported to
+// projectID.
+func (e *traceExporter) spanResource(s *trace.SpanData, projectID string) *monitoredrespb.MonitoredResource {
+	if get := e.o.SpanResource.GetResource; get != nil {
+		return get(s)
+	}
+	mr := e.o.Resource
+	if mr == nil || projectID == e.projectID {
+		return mr
+	}
+	if p, ok := mr.Labels["project_id"]; !ok || p == projectID {
+		return mr
+	}
+	mr = proto.Clone(mr).(*monitoredrespb.MonitoredResource)
+	mr.Labels["project_id"] = projectID
+	return mr
+}
@@ -0,0 +1,119 @@
+// Copyright 2019, OpenCensus Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package stackdriver
+
+import (
+	"sort"
+	"testing"
+
+	"go.opencensus.io/trace"
+	monitoredrespb "google.golang.org/genproto/googleapis/api/monitoredres"
+	tracepb "google.golang.org/genproto/googleapis/devtools/cloudtrace/v2"
+)
+
+func TestSpanResourceAttributes(t *testing.T) {
+	mr := createGCEInstanceMonitoredResource()
+	for _, tt := range []struct {
+		name string
+		o    SpanResourceOptions
+		want []string
+	}{
+		{
+			name: "default",
+			want: []string{"g.co/r/gce_instance/instance_id", "g.co/r/gce_instance/project_id", "g.co/r/gce_instance/zone"},
+		},
+		{
+			name: "selected labels",
+			o:    SpanResourceOptions{Labels: []string{"instance_id", "zone"}},
+			want: []string{"g.co/r/gce_instance/instance_id", "g.co/r/gce_instance/zone"},
+		},
+		{
+			name: "no labels",
+			o:    SpanResourceOptions{Labels: []string{}},
+		},
+		{
+			name: "well-known attributes",
+			o:    SpanResourceOptions{Labels: []string{"instance_id", "zone"}, WellKnownAttributes: true},
+			want: []string{"g.co/gce/instanceid", "g.co/r/gce_instance/zone"},
+		},
+	} {
+		po := newSpanProtoOptions(Options{SpanResource: tt.o})
+		span := protoFromSpanData(&trace.SpanData{Name: "span"}, "testproject", mr, po)
+		var got []string
+		for k := range span.GetAttributes().GetAttributeMap() {
+			if k != agentLabel {
+				got = append(got, k)
+			}
+		}
+		sort.Strings(got)
+		if len(got) != len(tt.want) {
+			t.Errorf("%s: attributes = %v; want %v", tt.name, got, tt.want)
+			continue
+		}
+		for i := range got {
+			if got[i] != tt.want[i] {
+				t.Errorf("%s: attributes = %v; want %v", tt.name, got, tt.want)
+				break
+			}
+		}
+	}
+}
+
+func TestSpanResource(t *testing.T) {
+	newExporter := func(o Options) (*traceExporter, *[]*tracepb.Span) {
+		e := newTraceExporterWithClient(o, nil)
+		var got []*tracepb.Span
+		e.uploadFn = func(spans []*tracepb.Span) {
+			got = append(got, spans...)
+		}
+		return e, &got
+	}
+
+	e, got := newExporter(Options{
+		ProjectID:        "project-test",
+		Resource:         createGCEInstanceMonitoredResource(),
+		GetSpanProjectID: ProjectIDFromSpanAttribute("tenant"),
+	})
+	e.ExportSpan(&trace.SpanData{Name: "tenant", Attributes: map[string]interface{}{"tenant": "tenant-a"}})
+	e.ExportSpan(&trace.SpanData{Name: "default"})
+	e.Flush()
+	if len(*got) != 2 {
+		t.Fatalf("got %d spans; want 2", len(*got))
+	}
+	checkExepectedMonitoredResourceKV("g.co/r/gce_instance/project_id", "tenant-a", (*got)[0], t)
+	checkExepectedMonitoredResourceKV("g.co/r/gce_instance/project_id", "project-test", (*got)[1], t)
+	if p := e.o.Resource.Labels["project_id"]; p != "project-test" {
+		t.Errorf("exporter resource project_id changed to %q", p)
+	}
+
+	e, got = newExporter(Options{
+		ProjectID: "project-test",
+		Resource:  createGCEInstanceMonitoredResource(),
+		SpanResource: SpanResourceOptions{
+			GetResource: func(s *trace.SpanData) *monitoredrespb.MonitoredResource {
+				return &monitoredrespb.MonitoredResource{Type: "generic_task", Labels: map[string]string{"job": s.Name}}
+			},
+		},
+	})
+	e.ExportSpan(&trace.SpanData{Name: "job1"})
+	e.Flush()
+	if len(*got) != 1 {
+		t.Fatalf("got %d spans; want 1", len(*got))
+	}
+	checkExepectedMonitoredResourceKV("g.co/r/generic_task/job", "job1", (*got)[0], t)
+	if _, ok := (*got)[0].Attributes.AttributeMap["g.co/r/gce_instance/zone"]; ok {
+		t.Error("span has the exporter resource; want the one returned by GetResource")
+	}
+}
@@ -0,0 +1,163 @@
+// Copyright 2019, OpenCensus Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package stackdriver
+
+import (
+	"hash/fnv"
+	"os"
+	"runtime"
+	"strconv"
+	"strings"
+	"sync"
+
+	"go.opencensus.io/trace"
+	tracepb "google.golang.org/genproto/googleapis/devtools/cloudtrace/v2"
+)
+
+const (
+	maxStackFrames          = 128
+	maxStackTraceCacheSize  = 4096
+	maxStackFunctionNameLen = 1024
+	maxStackFileNameLen     = 256
+	maxStackModuleNameLen   = 256
+)
+
+// Leading frames from these functions belong to the span machinery and are
+// not included in captured stack traces.
+var internalFramePrefixes = []string{
+	"runtime.Callers",
+	"go.opencensus.io/trace.",
+	"contrib.go.opencensus.io/exporter/stackdriver.(*Exporter).",
+	"contrib.go.opencensus.io/exporter/stackdriver.(*traceExporter).",
+	"contrib.go.opencensus.io/exporter/stackdriver.captureStackTrace",
+}
+
+var loadModule = &tracepb.Module{
+	Module: trunc(os.Args[0], maxStackModuleNameLen),
+}
+
+// stackTraceCache remembers which stack traces were already sent in full
+// for a trace, so that later spans of the same trace only send the hash ID.
+type stackTraceCache struct {
+	mu   sync.Mutex
+	seen map[string]struct{}
+}
+
+// sent reports whether the stack trace with the given hash was already
+// sent as part of the trace.
+func (c *stackTraceCache) sent(traceID trace.TraceID, hash int64) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	_, ok := c.seen[stackTraceKey(traceID, hash)]
+	return ok
+}
+
+// markSent records that the frames of st were sent as part of the trace.
+// Stack traces that only have a hash ID are ignored.
+func (c *stackTraceCache) markSent(traceID trace.TraceID, st *tracepb.StackTrace) {
+	if st.GetStackFrames() == nil {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.seen == nil || len(c.seen) >= maxStackTraceCacheSize {
+		c.seen = make(map[string]struct{})
+	}
+	c.seen[stackTraceKey(traceID, st.StackTraceHashId)] = struct{}{}
+}
+
+func stackTraceKey(traceID trace.TraceID, hash int64) string {
+	return traceID.String() + "/" + strconv.FormatInt(hash, 16)
+}
+
+// shouldCaptureStackTrace reports whether a stack trace should be attached
+// to s according to the exporter options.
+func shouldCaptureStackTrace(o Options, s *trace.SpanData) bool {
+	if o.CaptureStackTraces && s.Status.Code != trace.StatusCodeOK {
+		return true
+	}
+	if o.StackTraceAttribute != "" {
+		if _, ok := s.Attributes[o.StackTraceAttribute]; ok {
+			return true
+		}
+	}
+	return false
+}
+
+// captureStackTrace returns the stack trace of the calling goroutine,
+// without the leading frames of the exporter and the trace package. Called
+// from ExportSpan, this is the stack of the Span.End call.
+func captureStackTrace() []runtime.Frame {
+	pcs := make([]uintptr, maxStackFrames+16)
+	n := runtime.Callers(0, pcs)
+	frames := runtime.CallersFrames(pcs[:n])
+	var out []runtime.Frame
+	leading := true
+	for {
+		f, more := frames.Next()
+		if leading && isInternalFrame(f.Function) {
+			if !more {
+				break
+			}
+			continue
+		}
+		leading = false
+		out = append(out, f)
+		if !more || len(out) == maxStackFrames {
+			break
+		}
+	}
+	return out
+}
+
+func isInternalFrame(function string) bool {
+	for _, p := range internalFramePrefixes {
+		if strings.HasPrefix(function, p) {
+			return true
+		}
+	}
+	return false
+}
+
+// stackTraceProto converts frames to a StackTrace proto. If the same stack
+// trace was already sent for the trace, only the hash ID is set. The caller
+// marks the frames as sent with markSent once the span is accepted for
+// upload.
+func (c *stackTraceCache) stackTraceProto(traceID trace.TraceID, frames []runtime.Frame) *tracepb.StackTrace {
+	h := fnv.New64a()
+	for _, f := range frames {
+		h.Write([]byte(f.Function))
+		h.Write([]byte(f.File))
+		h.Write([]byte(strconv.Itoa(f.Line)))
+	}
+	st := &tracepb.StackTrace{
+		StackTraceHashId: int64(h.Sum64()),
+	}
+	if c.sent(traceID, st.StackTraceHashId) {
+		return st
+	}
+	st.StackFrames = &tracepb.StackTrace_StackFrames{
+		Frame: make([]*tracepb.StackTrace_StackFrame, 0, len(frames)),
+	}
+	for _, f := range frames {
+		st.StackFrames.Frame = append(st.StackFrames.Frame, &tracepb.StackTrace_StackFrame{
+			FunctionName: trunc(f.Function, maxStackFunctionNameLen),
+			FileName:     trunc(f.File, maxStackFileNameLen),
+			LineNumber:   int64(f.Line),
+			LoadModule:   loadModule,
+		})
+	}
+	return st
+}
@@ -0,0 +1,84 @@
+// Copyright 2019, OpenCensus Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package stackdriver
+
+import (
+	"runtime"
+	"testing"
+
+	"go.opencensus.io/trace"
+	tracepb "google.golang.org/genproto/googleapis/devtools/cloudtrace/v2"
+)
+
+func TestStackTraceCacheMarkSent(t *testing.T) {
+	var c stackTraceCache
+	tid := trace.TraceID{1}
+	frames := []runtime.Frame{{Function: "main.handle", File: "main.go", Line: 10}}
+
+	st := c.stackTraceProto(tid, frames)
+	if st.GetStackFrames() == nil {
+		t.Fatal("first stack trace has no frames")
+	}
+	if again := c.stackTraceProto(tid, frames); again.GetStackFrames() == nil {
+		t.Error("stack trace not marked as sent lost its frames")
+	}
+
+	c.markSent(tid, &tracepb.StackTrace{StackTraceHashId: st.StackTraceHashId})
+	if again := c.stackTraceProto(tid, frames); again.GetStackFrames() == nil {
+		t.Error("marking a hash-only stack trace as sent dropped the frames")
+	}
+
+	c.markSent(tid, st)
+	again := c.stackTraceProto(tid, frames)
+	if again.GetStackFrames() != nil || again.StackTraceHashId != st.StackTraceHashId {
+		t.Errorf("stack trace sent before = %v; want only hash ID %d", again, st.StackTraceHashId)
+	}
+	if other := c.stackTraceProto(trace.TraceID{2}, frames); other.GetStackFrames() == nil {
+		t.Error("stack trace sent in another trace has no frames")
+	}
+}
+
+func TestStackTraceResentAfterTrim(t *testing.T) {
+	e := newTraceExporterWithClient(Options{
+		CaptureStackTraces:        true,
+		TraceSpansMaxRequestBytes: 2000,
+	}, nil)
+	var got []*tracepb.Span
+	e.uploadFn = func(spans []*tracepb.Span) {
+		got = append(got, spans...)
+	}
+	tid := trace.TraceID{1}
+	oversized := makeSampleSpanData()
+	oversized.SpanContext = trace.SpanContext{TraceID: tid}
+	oversized.Status = trace.Status{Code: trace.StatusCodeInternal}
+	// Both spans are exported from the same line, so they have the same
+	// stack trace.
+	for _, sd := range []*trace.SpanData{
+		oversized,
+		{SpanContext: trace.SpanContext{TraceID: tid}, Status: oversized.Status},
+	} {
+		e.ExportSpan(sd)
+	}
+	e.Flush()
+	if len(got) != 2 {
+		t.Fatalf("got %d spans; want 2", len(got))
+	}
+	if got[0].StackTrace != nil {
+		t.Errorf("oversized span kept its stack trace")
+	}
+	if got[1].StackTrace.GetStackFrames() == nil {
+		t.Errorf("stack trace trimmed from the first span was not sent in full: %v", got[1].StackTrace)
+	}
+}
@@ -17,9 +17,11 @@ package stackdriver
 import (
 	"context"
 	"fmt"
+	"strings"
 	"testing"
 	"time"
 
+	"github.com/golang/protobuf/proto"
 	"go.opencensus.io/trace"
 	tracepb "google.golang.org/genproto/googleapis/devtools/cloudtrace/v2"
 )
@@ -81,6 +83,8 @@ func TestTraceSpansBufferMaxBytes(t *testing.T) {
 		Context:                  context.Background(),
 		Timeout:                  10 * time.Millisecond,
 		TraceSpansBufferMaxBytes: 20000,
+		// Room for two sample spans per request.
+		TraceSpansMaxRequestBytes: 12000,
 	}, nil)
 	waitCh := make(chan struct{})
 	exported := 0
@@ -98,6 +102,65 @@ func TestTraceSpansBufferMaxBytes(t *testing.T) {
 	}
 }
 
+func TestTraceSpansMaxRequestBytes(t *testing.T) {
+	e := newTraceExporterWithClient(Options{
+		TraceSpansMaxRequestBytes: 12000,
+	}, nil)
+	var bundles [][]*tracepb.Span
+	e.uploadFn = func(spans []*tracepb.Span) {
+		bundles = append(bundles, spans)
+	}
+	for i := 0; i < 5; i++ {
+		e.ExportSpan(makeSampleSpanData())
+	}
+	e.Flush()
+	if len(bundles) != 3 {
+		t.Fatalf("got %d bundles; want 3", len(bundles))
+	}
+	for _, spans := range bundles {
+		req := &tracepb.BatchWriteSpansRequest{Name: "projects/" + strings.Repeat("x", 30), Spans: spans}
+		if size := proto.Size(req); size > 12000 {
+			t.Errorf("request size = %d; want at most 12000", size)
+		}
+	}
+}
+
+func TestTrimOversizedSpan(t *testing.T) {
+	e := newTraceExporterWithClient(Options{
+		TraceSpansMaxRequestBytes: 2000,
+	}, nil)
+	var got []*tracepb.Span
+	e.uploadFn = func(spans []*tracepb.Span) {
+		got = append(got, spans...)
+	}
+	sd := makeSampleSpanData()
+	sd.Attributes["http.path"] = "/users"
+	e.ExportSpan(sd)
+	e.Flush()
+	if len(got) != 1 {
+		t.Fatalf("got %d spans; want 1", len(got))
+	}
+	sp := got[0]
+	if size := proto.Size(sp); size > 2000 {
+		t.Errorf("span size = %d; want at most 2000", size)
+	}
+	if n := len(sp.TimeEvents.GetTimeEvent()); n != 0 {
+		t.Errorf("span has %d time events; want 0", n)
+	}
+	if got, want := sp.TimeEvents.DroppedAnnotationsCount, int32(32); got != want {
+		t.Errorf("DroppedAnnotationsCount = %d; want %d", got, want)
+	}
+	if got, want := sp.TimeEvents.DroppedMessageEventsCount, int32(128); got != want {
+		t.Errorf("DroppedMessageEventsCount = %d; want %d", got, want)
+	}
+	if sp.Links.DroppedLinksCount == 0 || sp.Attributes.DroppedAttributesCount == 0 {
+		t.Errorf("links and attributes were not trimmed: %v", sp)
+	}
+	if _, ok := sp.Attributes.AttributeMap[labelHTTPPath]; !ok {
+		t.Errorf("priority attribute %q was dropped", labelHTTPPath)
+	}
+}
+
 func makeSampleSpanData() *trace.SpanData {
 	sd := &trace.SpanData{
 		Annotations:   make([]trace.Annotation, 32),
@@ -110,3 +173,48 @@ func makeSampleSpanData() *trace.SpanData {
 	}
 	return sd
 }
+
+func TestStackTraces(t *testing.T) {
+	e := newTraceExporterWithClient(Options{
+		CaptureStackTraces:   true,
+		StackTraceAttribute:  "debug.stack",
+		BundleCountThreshold: 1,
+	}, nil)
+	var got []*tracepb.Span
+	e.uploadFn = func(spans []*tracepb.Span) {
+		got = append(got, spans...)
+	}
+	tid := trace.TraceID{1}
+	for _, sd := range []*trace.SpanData{
+		{SpanContext: trace.SpanContext{TraceID: tid}, Name: "ok"},
+		{SpanContext: trace.SpanContext{TraceID: tid}, Name: "failed", Status: trace.Status{Code: trace.StatusCodeInternal}},
+		{SpanContext: trace.SpanContext{TraceID: tid}, Name: "failed", Status: trace.Status{Code: trace.StatusCodeInternal}},
+		{SpanContext: trace.SpanContext{TraceID: trace.TraceID{2}}, Name: "marked", Attributes: map[string]interface{}{"debug.stack": true}},
+	} {
+		e.ExportSpan(sd)
+	}
+	e.Flush()
+	if len(got) != 4 {
+		t.Fatalf("got %d spans; want 4", len(got))
+	}
+	if got[0].StackTrace != nil {
+		t.Errorf("span with OK status has a stack trace")
+	}
+	first, second, marked := got[1].StackTrace, got[2].StackTrace, got[3].StackTrace
+	if first == nil || second == nil || marked == nil {
+		t.Fatalf("missing stack traces: %v, %v, %v", first, second, marked)
+	}
+	frames := first.GetStackFrames().GetFrame()
+	if len(frames) == 0 {
+		t.Fatal("first stack trace has no frames")
+	}
+	if fn := frames[0].FunctionName.Value; !strings.HasSuffix(fn, "TestStackTraces") {
+		t.Errorf("top frame = %q; want TestStackTraces", fn)
+	}
+	if second.StackTraceHashId != first.StackTraceHashId || second.StackFrames != nil {
+		t.Errorf("repeated stack trace was not deduplicated: %v", second)
+	}
+	if marked.StackFrames == nil {
+		t.Errorf("stack trace in a different trace was deduplicated")
+	}
+}
@@ -0,0 +1,144 @@
+// Copyright 2019, OpenCensus Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package stackdriver
+
+import (
+	"reflect"
+	"sync"
+
+	metricpb "google.golang.org/genproto/googleapis/api/metric"
+)
+
+// errorHandler calls the current OnError hook of an exporter, which
+// Exporter.Update can replace.
+type errorHandler struct {
+	mu      sync.RWMutex
+	onError func(error)
+}
+
+func (h *errorHandler) set(onError func(error)) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.onError = onError
+}
+
+func (h *errorHandler) handle(err error) {
+	h.mu.RLock()
+	onError := h.onError
+	h.mu.RUnlock()
+	Options{OnError: onError}.handleError(err)
+}
+
+// Update reconfigures a running exporter without losing its caches of
+// created metric descriptors or the data it is bundling. Only the following
+// fields of o are applied; all others are ignored and keep the values given
+// to NewExporter:
+//
+//   - OnError
+//   - DefaultTraceAttributes and SpanFilters, for spans exported afterwards
+//   - DefaultMonitoringLabels, for data uploaded afterwards; metric
+//     descriptors are created again with the new labels
+//   - BundleDelayThreshold, BundleCountThreshold and TraceSpansBufferMaxBytes
+//
+// Update replaces these fields, it doesn't merge them: each one takes the
+// value it has in o, even if it is the zero value. An Options holding only
+// the fields to change therefore also removes the default trace attributes,
+// span filters and default monitoring labels, restores the default bundle
+// options and makes errors go to the log. Pass the complete options, such
+// as a copy of those given to NewExporter with the changes applied.
+//
+// New bundle options take effect through new bundlers: data already
+// bundled is uploaded with the old settings while new data goes to the new
+// bundlers. Span sampling is not part of the exporter and is changed with
+// trace.ApplyConfig.
+//
+// Update validates o like NewExporter, with SpanMetricsViews if span metrics
+// were enabled by NewExporter, and changes nothing if Validate reports
+// errors. It is safe to call concurrently with exporting.
+func (e *Exporter) Update(o Options) error {
+	// Span metrics are registered by NewExporter and can't be toggled here,
+	// but the new default labels must not clash with their tag keys.
+	if err := o.validateExporter(e.statsExporter.o.EnableSpanMetrics); err != nil {
+		return err
+	}
+
+	if e.onError != nil {
+		e.onError.set(o.OnError)
+	}
+	e.traceExporter.update(o)
+	e.statsExporter.update(o)
+	return nil
+}
+
+// update applies the hot-swappable trace options of o.
+func (e *traceExporter) update(o Options) {
+	var filters *spanFilters
+	if len(o.SpanFilters) > 0 {
+		filters = newSpanFilters(o.SpanFilters)
+	}
+
+	e.mu.Lock()
+	old := e.bundler
+	e.bundler = e.newBundler(o)
+	e.defaultAttributes = o.DefaultTraceAttributes
+	if filters != nil && e.filters != nil {
+		filters.carryOver(e.filters)
+	}
+	e.filters = filters
+	e.mu.Unlock()
+
+	// Spans added before the swap are uploaded by the old bundler.
+	old.Flush()
+}
+
+// update applies the hot-swappable stats options of o.
+func (se *statsExporter) update(o Options) {
+	labels := defaultLabelsFromOptions(o)
+
+	se.mu.Lock()
+	oldViewData, oldProtoMetrics, oldMetrics := se.viewDataBundler, se.protoMetricsBundler, se.metricsBundler
+	se.newBundlers(o)
+	labelsChanged := !reflect.DeepEqual(labels, se.defaultLabels)
+	se.defaultLabels = labels
+	se.mu.Unlock()
+
+	if labelsChanged {
+		se.resetMetricDescriptors()
+	}
+
+	oldViewData.Flush()
+	oldProtoMetrics.Flush()
+	oldMetrics.Flush()
+}
+
+// resetMetricDescriptors forgets the metric descriptors created so far, so
+// that they are created again on the next upload.
+func (se *statsExporter) resetMetricDescriptors() {
+	se.createdViewsMu.Lock()
+	se.createdViews = make(map[string]*metricpb.MetricDescriptor)
+	se.createdViewsMu.Unlock()
+
+	se.protoMu.Lock()
+	se.protoMetricDescriptors = make(map[string]*metricpb.MetricDescriptor)
+	se.protoMu.Unlock()
+
+	se.metricMu.Lock()
+	se.metricDescriptors = make(map[string]*metricpb.MetricDescriptor)
+	se.metricMu.Unlock()
+
+	se.routedMu.Lock()
+	se.routedMetricDescriptors = nil
+	se.routedMu.Unlock()
+}
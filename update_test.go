@@ -0,0 +1,153 @@
+// Copyright 2019, OpenCensus Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package stackdriver
+
+import (
+	"context"
+	"errors"
+	"regexp"
+	"sync"
+	"testing"
+
+	"go.opencensus.io/resource"
+	"go.opencensus.io/trace"
+	metricpb "google.golang.org/genproto/googleapis/api/metric"
+	monitoredrespb "google.golang.org/genproto/googleapis/api/monitoredres"
+	tracepb "google.golang.org/genproto/googleapis/devtools/cloudtrace/v2"
+)
+
+func TestUpdate(t *testing.T) {
+	var firstErrs, secondErrs []error
+	e, err := NewExporter(Options{
+		ProjectID:               "p",
+		Location:                "us-central1-a",
+		BundleCountThreshold:    100,
+		DefaultTraceAttributes:  map[string]interface{}{"version": "1"},
+		OnError:                 func(err error) { firstErrs = append(firstErrs, err) },
+		MonitoringClientOptions: authOptions,
+		TraceClientOptions:      authOptions,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var mu sync.Mutex
+	var got []*tracepb.Span
+	e.traceExporter.uploadFn = func(spans []*tracepb.Span) {
+		mu.Lock()
+		defer mu.Unlock()
+		got = append(got, spans...)
+	}
+	e.statsExporter.createdViews["v"] = &metricpb.MetricDescriptor{}
+
+	e.ExportSpan(&trace.SpanData{Name: "before"})
+
+	labels := &Labels{}
+	labels.Set("env", "prod", "")
+	err = e.Update(Options{
+		BundleCountThreshold:    1,
+		DefaultTraceAttributes:  map[string]interface{}{"version": "2"},
+		DefaultMonitoringLabels: labels,
+		SpanFilters:             []SpanFilter{{Name: "debug", NamePattern: regexp.MustCompile("^debug")}},
+		OnError:                 func(err error) { secondErrs = append(secondErrs, err) },
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	mu.Lock()
+	if len(got) != 1 || got[0].Attributes.AttributeMap["version"].GetStringValue().GetValue() != "1" {
+		t.Errorf("span bundled before Update was not uploaded with the old attributes: %v", got)
+	}
+	mu.Unlock()
+
+	e.ExportSpan(&trace.SpanData{Name: "after"})
+	e.ExportSpan(&trace.SpanData{Name: "debug/skipped"})
+	e.Flush()
+	mu.Lock()
+	if len(got) != 2 || got[1].Attributes.AttributeMap["version"].GetStringValue().GetValue() != "2" {
+		t.Errorf("span exported after Update does not have the new attributes: %v", got)
+	}
+	mu.Unlock()
+	if n := e.FilteredSpanCounts()["debug"]; n != 1 {
+		t.Errorf("FilteredSpanCounts()[debug] = %d; want 1", n)
+	}
+	if n := e.traceExporter.currentBundler().BundleCountThreshold; n != 1 {
+		t.Errorf("trace BundleCountThreshold = %d; want 1", n)
+	}
+	viewData, _, _ := e.statsExporter.bundlers()
+	if n := viewData.BundleCountThreshold; n != 1 {
+		t.Errorf("stats BundleCountThreshold = %d; want 1", n)
+	}
+	if got := e.statsExporter.labels(); len(got) != 1 || got["env"].val != "prod" {
+		t.Errorf("default labels = %v; want env=prod", got)
+	}
+	if n := len(e.statsExporter.createdViews); n != 0 {
+		t.Errorf("%d metric descriptors still cached after the labels changed; want 0", n)
+	}
+
+	e.onError.handle(errors.New("upload failed"))
+	if len(firstErrs) != 0 || len(secondErrs) != 1 {
+		t.Errorf("errors went to the old hook %d times and the new one %d times; want 0 and 1", len(firstErrs), len(secondErrs))
+	}
+
+	err = e.Update(Options{
+		BundleCountThreshold: 5,
+		Resource:             &monitoredrespb.MonitoredResource{Type: "global"},
+		ResourceDetector: func(context.Context) (*resource.Resource, error) {
+			return nil, nil
+		},
+	})
+	if err == nil {
+		t.Fatal("Update() with conflicting options succeeded; want error")
+	}
+	if n := e.traceExporter.currentBundler().BundleCountThreshold; n != 1 {
+		t.Errorf("failed Update changed BundleCountThreshold to %d", n)
+	}
+}
+
+func TestUpdateValidatesSpanMetricsLabels(t *testing.T) {
+	e := &Exporter{statsExporter: &statsExporter{o: Options{EnableSpanMetrics: true}}}
+	labels := &Labels{}
+	labels.Set("span_name", "x", "")
+	err := e.Update(Options{DefaultMonitoringLabels: labels})
+	if _, ok := err.(*ValidationError); !ok {
+		t.Fatalf("Update() = %v; want a *ValidationError for the span_name label", err)
+	}
+}
+
+func TestUpdateResetsZeroFields(t *testing.T) {
+	labels := &Labels{}
+	labels.Set("env", "prod", "")
+	e, err := NewExporter(Options{
+		ProjectID:               "p",
+		Location:                "us-central1-a",
+		DefaultTraceAttributes:  map[string]interface{}{"version": "1"},
+		DefaultMonitoringLabels: labels,
+		MonitoringClientOptions: authOptions,
+		TraceClientOptions:      authOptions,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := e.Update(Options{BundleCountThreshold: 1}); err != nil {
+		t.Fatal(err)
+	}
+	if got := e.traceExporter.defaultTraceAttributes(); got != nil {
+		t.Errorf("default trace attributes = %v after Update without them; want nil", got)
+	}
+	if got := e.statsExporter.labels(); got["env"].val != "" {
+		t.Errorf("default labels = %v after Update without them; want the defaults", got)
+	}
+}
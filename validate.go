@@ -0,0 +1,137 @@
+// Copyright 2019, OpenCensus Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package stackdriver
+
+import (
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"go.opencensus.io/stats/view"
+)
+
+const (
+	// minReportingInterval is the minimum interval between two points of a
+	// time series accepted by Stackdriver Monitoring.
+	minReportingInterval = 10 * time.Second
+)
+
+// ValidationError lists the problems found by Options.Validate.
+//
+// Errors are options that cannot work and make NewExporter fail. Warnings
+// are options that are likely mistakes but are accepted; NewExporter
+// reports them through OnError.
+type ValidationError struct {
+	Errors   []string
+	Warnings []string
+}
+
+func (e *ValidationError) Error() string {
+	problems := make([]string, 0, len(e.Errors)+len(e.Warnings))
+	problems = append(problems, e.Errors...)
+	for _, w := range e.Warnings {
+		problems = append(problems, "warning: "+w)
+	}
+	return "stackdriver: invalid options: " + strings.Join(problems, "; ")
+}
+
+// Validate checks the options for conflicts and likely mistakes, and returns
+// all problems found as a *ValidationError, or nil if there are none. The
+// default monitoring labels are checked against the tag keys of views.
+//
+// NewExporter calls Validate, with SpanMetricsViews if EnableSpanMetrics is
+// set.
+func (o Options) Validate(views ...*view.View) error {
+	ve := &ValidationError{}
+	errorf := func(format string, args ...interface{}) {
+		ve.Errors = append(ve.Errors, fmt.Sprintf(format, args...))
+	}
+	warnf := func(format string, args ...interface{}) {
+		ve.Warnings = append(ve.Warnings, fmt.Sprintf(format, args...))
+	}
+
+	if o.ResourceDetector != nil && (o.Resource != nil || o.MonitoredResource != nil) {
+		errorf("ResourceDetector must not be used in combination with deprecated resource fields")
+	}
+	if o.MonitoredResource != nil && o.GetMonitoredResource != nil {
+		warnf("MonitoredResource is ignored for views because GetMonitoredResource is set")
+	}
+	if o.GetMonitoredResource != nil && o.GetMetricResource != nil {
+		warnf("GetMonitoredResource is ignored because GetMetricResource is set")
+	}
+	if o.ReportingInterval > 0 && o.ReportingInterval < minReportingInterval {
+		warnf("ReportingInterval %v is below %v; Stackdriver Monitoring rejects points written more often", o.ReportingInterval, minReportingInterval)
+	}
+	if o.BundleCountThreshold > maxTimeSeriesPerUpload {
+		warnf("BundleCountThreshold %d is above %d; bundles are split into several requests", o.BundleCountThreshold, maxTimeSeriesPerUpload)
+	}
+	if p := o.MetricPrefix; p != "" && o.GetMetricDisplayName == nil && !hasDomain(p) {
+		warnf("MetricPrefix %q only prefixes display names; metric types stay under custom.googleapis.com/opencensus/, use GetMetricType to change them", p)
+	}
+	if o.DefaultMonitoringLabels != nil {
+		defaults := make(map[string]string, len(o.DefaultMonitoringLabels.m))
+		for k := range o.DefaultMonitoringLabels.m {
+			defaults[sanitize(k)] = k
+		}
+		for _, v := range views {
+			for _, k := range v.TagKeys {
+				if label, ok := defaults[sanitize(k.Name())]; ok {
+					errorf("default monitoring label %q clashes with tag key %q of view %q", label, k.Name(), v.Name)
+				}
+			}
+		}
+	}
+
+	if len(ve.Errors) == 0 && len(ve.Warnings) == 0 {
+		return nil
+	}
+	return ve
+}
+
+// validateExporter validates o for NewExporter and Update, with
+// SpanMetricsViews if spanMetrics is set. Warnings are reported through
+// OnError, or logged if it is nil; only errors are returned.
+func (o Options) validateExporter(spanMetrics bool) error {
+	var views []*view.View
+	if spanMetrics {
+		views = SpanMetricsViews
+	}
+	err := o.Validate(views...)
+	if err == nil {
+		return nil
+	}
+	ve := err.(*ValidationError)
+	if len(ve.Errors) > 0 {
+		return err
+	}
+	for _, w := range ve.Warnings {
+		// Warnings don't prevent the exporter from working.
+		err := fmt.Errorf("stackdriver: %s", w)
+		if o.OnError != nil {
+			o.OnError(err)
+		} else {
+			log.Print(err)
+		}
+	}
+	return nil
+}
+
+// hasDomain reports whether the first path segment of p looks like a domain,
+// as in "custom.googleapis.com/myapp".
+func hasDomain(p string) bool {
+	first := strings.SplitN(p, "/", 2)[0]
+	return strings.Contains(first, ".")
+}
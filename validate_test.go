@@ -0,0 +1,108 @@
+// Copyright 2019, OpenCensus Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package stackdriver
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"contrib.go.opencensus.io/exporter/stackdriver/monitoredresource"
+	"go.opencensus.io/resource"
+	"go.opencensus.io/stats/view"
+	"go.opencensus.io/tag"
+	monitoredrespb "google.golang.org/genproto/googleapis/api/monitoredres"
+)
+
+type fakeMonitoredResource struct{}
+
+func (fakeMonitoredResource) MonitoredResource() (string, map[string]string) {
+	return "global", nil
+}
+
+func TestValidate(t *testing.T) {
+	if err := (Options{ProjectID: "p"}).Validate(); err != nil {
+		t.Fatalf("Validate() = %v; want nil", err)
+	}
+
+	labels := &Labels{}
+	labels.Set("service", "checkout", "")
+	o := Options{
+		ProjectID: "p",
+		Resource:  &monitoredrespb.MonitoredResource{Type: "global"},
+		ResourceDetector: func(context.Context) (*resource.Resource, error) {
+			return nil, nil
+		},
+		MonitoredResource: fakeMonitoredResource{},
+		GetMonitoredResource: func(v *view.View, tags []tag.Tag) ([]tag.Tag, monitoredresource.Interface) {
+			return tags, nil
+		},
+		ReportingInterval:       5 * time.Second,
+		BundleCountThreshold:    500,
+		MetricPrefix:            "myapp",
+		DefaultMonitoringLabels: labels,
+	}
+	v := &view.View{Name: "requests", TagKeys: []tag.Key{tag.MustNewKey("service")}}
+	err := o.Validate(v)
+	ve, ok := err.(*ValidationError)
+	if !ok {
+		t.Fatalf("Validate() = %v; want a *ValidationError", err)
+	}
+	for _, tt := range []struct {
+		problems []string
+		want     []string
+	}{
+		{ve.Errors, []string{"ResourceDetector", `label "service" clashes with tag key "service" of view "requests"`}},
+		{ve.Warnings, []string{"GetMonitoredResource", "ReportingInterval 5s", "BundleCountThreshold 500", `MetricPrefix "myapp"`}},
+	} {
+		if len(tt.problems) != len(tt.want) {
+			t.Errorf("problems = %q; want %d", tt.problems, len(tt.want))
+			continue
+		}
+		for i, want := range tt.want {
+			if !strings.Contains(tt.problems[i], want) {
+				t.Errorf("problem %q does not mention %q", tt.problems[i], want)
+			}
+		}
+	}
+	want := o.Validate()
+	if _, err := NewExporter(o); err == nil || err.Error() != want.Error() {
+		t.Errorf("NewExporter() error = %v; want %v", err, want)
+	}
+}
+
+func TestValidateWarningsOnly(t *testing.T) {
+	var reported []error
+	o := Options{
+		ProjectID:         "p",
+		ReportingInterval: time.Second,
+		MetricPrefix:      "custom.googleapis.com/myapp",
+		OnError:           func(err error) { reported = append(reported, err) },
+
+		MonitoringClientOptions: authOptions,
+		TraceClientOptions:      authOptions,
+	}
+	ve, ok := o.Validate().(*ValidationError)
+	if !ok || len(ve.Errors) != 0 || len(ve.Warnings) != 1 {
+		t.Fatalf("Validate() = %v; want a single warning", ve)
+	}
+	if _, err := NewExporter(o); err != nil {
+		t.Fatalf("NewExporter() error = %v", err)
+	}
+	if len(reported) != 1 || !strings.Contains(reported[0].Error(), "ReportingInterval") {
+		t.Errorf("OnError received %v; want the ReportingInterval warning", reported)
+	}
+}